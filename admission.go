@@ -0,0 +1,5 @@
+package feng
+
+import "github.com/zmhuanf/feng/internal/core"
+
+type ConnectionStats = core.ConnectionStats
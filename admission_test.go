@@ -0,0 +1,149 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialTestGame(port int, origin string) (*websocket.Conn, int, error) {
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://127.0.0.1:%d/game", port), header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		return nil, status, err
+	}
+	return conn, http.StatusSwitchingProtocols, nil
+}
+
+func TestAllowedOrigins(t *testing.T) {
+	server := startTestServer(t, 22391, func(config *ServerConfig) {
+		config.AllowedOrigins = []string{"https://game.example.com", "https://*.cdn.example.com"}
+	})
+
+	for _, tc := range []struct {
+		origin string
+		status int
+	}{
+		{"https://game.example.com", http.StatusSwitchingProtocols},
+		{"https://eu.cdn.example.com", http.StatusSwitchingProtocols},
+		{"", http.StatusSwitchingProtocols},
+		{"https://evil.example.net", http.StatusForbidden},
+		{"https://cdn.example.com.evil.net", http.StatusForbidden},
+	} {
+		conn, status, _ := dialTestGame(22391, tc.origin)
+		if conn != nil {
+			_ = conn.Close()
+		}
+		if status != tc.status {
+			t.Fatalf("origin %q: expected %d, got %d", tc.origin, tc.status, status)
+		}
+	}
+	if stats := server.ConnectionStats(); stats.RejectedOrigin != 2 {
+		t.Fatalf("expected 2 rejected origins, got %+v", stats)
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	perIP := startTestServer(t, 22392, func(config *ServerConfig) {
+		config.MaxConnectionsPerIP = 2
+	})
+	total := startTestServer(t, 22393, func(config *ServerConfig) {
+		// 客户端模式下每个客户端同时持有 /system 和 /game 两个连接
+		config.MaxConnections = 2
+	})
+
+	for range 2 {
+		conn, _, err := dialTestGame(22392, "")
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		defer conn.Close()
+	}
+	if _, status, _ := dialTestGame(22392, ""); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected per ip limit, got %d", status)
+	}
+	// 未配置信任的代理时忽略伪造的转发请求头
+	header := http.Header{}
+	header.Set("X-Forwarded-For", "203.0.113.9")
+	if _, resp, _ := websocket.DefaultDialer.Dial("ws://127.0.0.1:22392/game", header); resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("expected forwarded header to be ignored")
+	}
+	if stats := perIP.ConnectionStats(); stats.Active != 2 || stats.RejectedPerIP != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 来自信任代理的连接按转发的客户端 IP 计数
+	startTestServer(t, 22395, func(config *ServerConfig) {
+		config.MaxConnectionsPerIP = 1
+		config.TrustedProxies = []string{"127.0.0.1"}
+	})
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+		header := http.Header{}
+		header.Set("X-Forwarded-For", ip)
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:22395/game", header)
+		if err != nil {
+			t.Fatalf("dial via trusted proxy failed: %v", err)
+		}
+		defer conn.Close()
+	}
+
+	first, err := connectAuthClient(22393, "", false)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	if _, err := connectAuthClient(22393, "", false); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected busy, got %v", err)
+	}
+	// 连接关闭后释放名额
+	_ = first.Close()
+	for i := 0; total.ConnectionStats().Active != 0; i++ {
+		if i == 100 {
+			t.Fatal("connection slot not released")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	second, err := connectAuthClient(22393, "", false)
+	if err != nil {
+		t.Fatalf("connect after release failed: %v", err)
+	}
+	_ = second.Close()
+	if stats := total.ConnectionStats(); stats.RejectedTotal != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	server := startTestServer(t, 22394, func(config *ServerConfig) {
+		config.MaxMessageSize = 1024
+	})
+	_ = server.Handle("/echo", func(ctx ServerContext, data string) (string, error) {
+		return data, nil
+	})
+	client, err := connectAuthClient(22394, "", false)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	if reply, err := Call[string, string](context.Background(), client, "/echo", "small"); err != nil || reply != "small" {
+		t.Fatalf("expected echo, got %q %v", reply, err)
+	}
+	_, err = Call[string, string](context.Background(), client, "/echo", strings.Repeat("x", 4096))
+	var e *Error
+	if !errors.As(err, &e) || e.Code != CodeConnectionLost {
+		t.Fatalf("expected connection closed for oversized message, got %v", err)
+	}
+}
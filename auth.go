@@ -0,0 +1,7 @@
+package feng
+
+import "github.com/zmhuanf/feng/internal/core"
+
+type AuthRequest = core.AuthRequest
+type Authenticator = core.Authenticator
+type AuthenticatorFunc = core.AuthenticatorFunc
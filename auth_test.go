@@ -0,0 +1,95 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// testAuthenticator 接受 "Bearer <id>" 请求头 token 查询参数或握手凭据 "<id>"
+var testAuthenticator = AuthenticatorFunc(func(ctx context.Context, req AuthRequest) (string, error) {
+	if id, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok && id != "mallory" {
+		return id, nil
+	}
+	if token := req.Query.Get("token"); token != "" {
+		return token, nil
+	}
+	if len(req.Credentials) > 0 && string(req.Credentials) != "mallory" {
+		return string(req.Credentials), nil
+	}
+	return "", errors.New("invalid credentials")
+})
+
+func startAuthServer(t *testing.T, port int, handshake bool) {
+	t.Helper()
+	server := startTestServer(t, port, func(config *ServerConfig) {
+		config.Authenticator = testAuthenticator
+		config.AuthHandshake = handshake
+	})
+	_ = server.Handle("/whoami", func(ctx ServerContext) (string, error) {
+		return ctx.User().ID(), nil
+	})
+}
+
+func connectAuthClient(port int, credentials string, handshake bool) (Client, error) {
+	config := NewDefaultClientConfig()
+	config.Port = port
+	config.Credentials = credentials
+	config.AuthHandshake = handshake
+	client := NewClient(config)
+	return client, client.Connect(context.Background())
+}
+
+func TestAuthenticateOnUpgrade(t *testing.T) {
+	startAuthServer(t, 22361, false)
+
+	client, err := connectAuthClient(22361, "Bearer alice", false)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+	if id, err := Call[any, string](context.Background(), client, "/whoami", nil); err != nil || id != "alice" {
+		t.Fatalf("expected alice, got %q %v", id, err)
+	}
+
+	if _, err := connectAuthClient(22361, "Bearer mallory", false); !errors.Is(err, ErrUnauthorized) || err.Error() != "invalid credentials" {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+
+	// 浏览器无法设置请求头 通过查询参数传递令牌
+	dialer := websocket.Dialer{}
+	conn, _, err := dialer.Dial("ws://127.0.0.1:22361/game?token=bob", nil)
+	if err != nil {
+		t.Fatalf("query token dial failed: %v", err)
+	}
+	_ = conn.Close()
+}
+
+func TestAuthenticateHandshake(t *testing.T) {
+	startAuthServer(t, 22362, true)
+
+	client, err := connectAuthClient(22362, "carol", true)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+	if id, err := Call[any, string](context.Background(), client, "/whoami", nil); err != nil || id != "carol" {
+		t.Fatalf("expected carol, got %q %v", id, err)
+	}
+
+	if _, err := connectAuthClient(22362, "mallory", true); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+	// 首条消息不是认证消息时连接被拒绝
+	plain, err := connectAuthClient(22362, "", false)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer plain.Close()
+	if _, err := Call[any, string](context.Background(), plain, "/whoami", nil); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unauthorized without handshake, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package feng
+
+import "github.com/zmhuanf/feng/internal/core"
+
+type Balancer = core.Balancer
+type Status = core.Status
+
+func NewLeastLoadBalancer() Balancer {
+	return core.NewLeastLoadBalancer()
+}
+
+func NewRoundRobinBalancer() Balancer {
+	return core.NewRoundRobinBalancer()
+}
+
+func NewWeightedRandomBalancer() Balancer {
+	return core.NewWeightedRandomBalancer()
+}
@@ -0,0 +1,205 @@
+package feng
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zmhuanf/feng/internal/protocol"
+)
+
+// gatherTestRoom 创建以 ID 为 host 的用户为房主的房间 并将所有在线用户移入
+func gatherTestRoom(t testing.TB, server Server, host string, count int) Room {
+	t.Helper()
+	for i := 0; len(server.Users()) < count; i++ {
+		if i == 100 {
+			t.Fatal("users not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	owner, err := server.User(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := server.CreateRoom(RoomOptions{Creator: owner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range server.Users() {
+		if user.ID() != host {
+			if err := user.JoinRoom(room); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return room
+}
+
+func TestRoomBroadcast(t *testing.T) {
+	server := startTestServer(t, 22421, func(config *ServerConfig) {
+		config.Authenticator = testAuthenticator
+	})
+	news := make(chan string, 16)
+	for _, id := range []string{"ann", "ben", "cat"} {
+		config := NewDefaultClientConfig()
+		config.Port = 22421
+		config.Credentials = "Bearer " + id
+		client := NewClient(config)
+		if err := client.Handle("/news", func(ctx ClientContext, text string) {
+			news <- id + ":" + text
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Connect(context.Background()); err != nil {
+			t.Fatalf("connect failed: %v", err)
+		}
+		defer client.Close()
+	}
+	room := gatherTestRoom(t, server, "ann", 3)
+
+	expect := func(want ...string) {
+		t.Helper()
+		got := make(map[string]bool)
+		for range want {
+			select {
+			case item := <-news:
+				got[item] = true
+			case <-time.After(2 * time.Second):
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+		for _, item := range want {
+			if !got[item] {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+	}
+
+	if err := room.Broadcast("/news", "all"); err != nil {
+		t.Fatal(err)
+	}
+	expect("ann:all", "ben:all", "cat:all")
+
+	if err := room.BroadcastExcept("/news", "others", "ann"); err != nil {
+		t.Fatal(err)
+	}
+	expect("ben:others", "cat:others")
+
+	err := server.Multicast("/news", "some", []string{"ben", "ghost"})
+	var report *MulticastError
+	if !errors.As(err, &report) || len(report.Errors) != 1 || !errors.Is(report.Errors["ghost"], ErrNotFound) {
+		t.Fatalf("expected ghost to be reported, got %v", err)
+	}
+	expect("ben:some")
+	select {
+	case item := <-news:
+		t.Fatalf("unexpected delivery %s", item)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type benchSnapshot struct {
+	Tick     int              `json:"tick"`
+	Entities []benchEntity    `json:"entities"`
+	Scores   map[string]int64 `json:"scores"`
+}
+
+type benchEntity struct {
+	ID     string  `json:"id"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Facing float64 `json:"facing"`
+	HP     int     `json:"hp"`
+}
+
+// pushFanout 按与 Broadcast 相同的方式分组并发发送 但每个用户各自编码和压缩
+func pushFanout(users []User, route string, data any) error {
+	groups := min(runtime.GOMAXPROCS(0), len(users))
+	size := (len(users) + groups - 1) / groups
+	errs := make(chan error, groups)
+	for start := 0; start < len(users); start += size {
+		group := users[start:min(start+size, len(users))]
+		go func() {
+			for _, user := range group {
+				if err := user.Push(route, data); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	var result error
+	for start := 0; start < len(users); start += size {
+		if err := <-errs; err != nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// BenchmarkRoomBroadcast 对比每个用户各自编码的推送与只编码一次的 Broadcast 房间内 100 个用户
+// 两者的分组并发方式相同 快照超过压缩阈值 差异只在于编码和压缩的次数
+func BenchmarkRoomBroadcast(b *testing.B) {
+	// 同步写入 避免读取速度跟不上时发送队列溢出断开连接
+	server := startTestServer(b, 22422, func(config *ServerConfig) {
+		config.SendQueueSize = -1
+		config.Compressor = NewZstdCompressor()
+	})
+	dialer := websocket.Dialer{Subprotocols: []string{protocol.Subprotocol}}
+	header := http.Header{}
+	header.Set(protocol.HeaderCompression, "zstd")
+	for range 100 {
+		conn, _, err := dialer.Dial("ws://127.0.0.1:22422/game", header)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { _ = conn.Close() })
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; len(server.Users()) < 100; i++ {
+		if i == 100 {
+			b.Fatal("users not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	room := gatherTestRoom(b, server, server.Users()[0].ID(), 100)
+
+	snapshot := benchSnapshot{Scores: make(map[string]int64)}
+	for i := range 20 {
+		id := fmt.Sprintf("unit-%d", i)
+		snapshot.Entities = append(snapshot.Entities, benchEntity{ID: id, X: float64(i), Y: float64(i) * 2, Facing: 0.5, HP: 100})
+		snapshot.Scores[id] = int64(i * 10)
+	}
+	if data, _ := json.Marshal(snapshot); len(data) < NewDefaultServerConfig().CompressThreshold {
+		b.Fatalf("snapshot of %d bytes is below the compression threshold", len(data))
+	}
+
+	b.Run("push-fanout", func(b *testing.B) {
+		users := room.Users()
+		for b.Loop() {
+			if err := pushFanout(users, "/snapshot", snapshot); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("broadcast", func(b *testing.B) {
+		for b.Loop() {
+			if err := room.Broadcast("/snapshot", snapshot); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package feng
+
+import (
+	"context"
+
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/router"
+)
+
+// Call 向服务器发送请求并把响应解码为 Resp
+func Call[Req, Resp any](ctx context.Context, client Client, route string, req Req) (Resp, error) {
+	data, err := client.RequestRaw(ctx, route, req)
+	if err != nil {
+		var zero Resp
+		return zero, err
+	}
+	return decodeResponse[Resp](data, client.Config().Codec)
+}
+
+// CallUser 在服务端向客户端发送请求并把响应解码为 Resp
+func CallUser[Req, Resp any](ctx context.Context, user User, route string, req Req) (Resp, error) {
+	data, err := user.RequestRaw(ctx, route, req)
+	if err != nil {
+		var zero Resp
+		return zero, err
+	}
+	return decodeResponse[Resp](data, user.Context().Server().Config().Codec)
+}
+
+// decodeResponse 解码响应 处理函数只返回 error 时响应为空 得到零值
+func decodeResponse[Resp any](data []byte, codec core.Codec) (Resp, error) {
+	if len(data) == 0 {
+		var zero Resp
+		return zero, nil
+	}
+	return router.Decode[Resp](data, codec)
+}
@@ -0,0 +1,56 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type testLoginReq struct {
+	Name string `json:"name"`
+}
+
+type testLoginResp struct {
+	ID    string `json:"id"`
+	Level int    `json:"level"`
+}
+
+func TestCall(t *testing.T) {
+	server := startTestServer(t, 22331, nil)
+	_ = server.Handle("/login", func(ctx ServerContext, req testLoginReq) (testLoginResp, error) {
+		if req.Name == "" {
+			return testLoginResp{}, NewError(CodeValidation, "empty name")
+		}
+		return testLoginResp{ID: "u-" + req.Name, Level: 3}, nil
+	})
+	_ = server.Handle("/ack", func(ctx ServerContext) error { return nil })
+	_ = server.Handle("/ask", func(ctx ServerContext, question string) (string, error) {
+		return CallUser[string, string](context.Background(), ctx.User(), "/answer", question)
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22331
+	client := NewClient(config)
+	_ = client.Handle("/answer", func(ctx ClientContext, question string) (string, error) {
+		return question + "!", nil
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := Call[testLoginReq, testLoginResp](context.Background(), client, "/login", testLoginReq{Name: "feng"})
+	if err != nil || resp.ID != "u-feng" || resp.Level != 3 {
+		t.Fatalf("unexpected login response: %+v %v", resp, err)
+	}
+	if _, err := Call[testLoginReq, testLoginResp](context.Background(), client, "/login", testLoginReq{}); !errors.Is(err, NewError(CodeValidation, "")) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if _, err := Call[any, struct{}](context.Background(), client, "/ack", nil); err != nil {
+		t.Fatalf("ack failed: %v", err)
+	}
+	answer, err := Call[string, string](context.Background(), client, "/ask", "why")
+	if err != nil || answer != "why!" {
+		t.Fatalf("unexpected answer %q %v", answer, err)
+	}
+}
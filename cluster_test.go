@@ -0,0 +1,354 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zmhuanf/feng/internal/core"
+)
+
+const testSignKey = "feng-test-sign-key"
+
+func startTestServer(t testing.TB, port int, setup func(*ServerConfig)) Server {
+	t.Helper()
+	config := NewDefaultServerConfig()
+	config.Addr = "127.0.0.1"
+	config.Port = port
+	config.NetworkSignKey = testSignKey
+	if setup != nil {
+		setup(&config)
+	}
+	server := NewServer(config)
+	name := fmt.Sprintf("node-%d", port)
+	if err := server.Handle("/node", func(ctx ServerContext) (string, error) {
+		return name, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = server.ListenAndServe(ctx) }()
+	t.Cleanup(cancel)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+			return server
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("server %s not ready", addr)
+	return nil
+}
+
+func joinTestNetwork(t *testing.T, gatewayPort, peerPort, load int) Client {
+	t.Helper()
+	config := NewDefaultClientConfig()
+	config.Port = gatewayPort
+	config.Mode = ModeServer
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect gateway failed: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	if err := joinTestSystem(client, fmt.Sprintf("127.0.0.1:%d", peerPort), testSignKey); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	reportTestLoad(t, client, load)
+	return client
+}
+
+// joinTestSystem 按挑战应答流程以节点身份加入
+func joinTestSystem(client Client, url, key string) error {
+	nonce, err := Call[any, string](context.Background(), client, "/challenge", nil)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	join := map[string]any{"url": url, "timestamp": timestamp, "nonce": nonce, "sign": core.SignChallenge(url, timestamp, nonce, key)}
+	return client.Request(context.Background(), "/join", join, func(ClientContext) {})
+}
+
+func reportTestLoad(t *testing.T, client Client, load int) {
+	t.Helper()
+	if err := client.Request(context.Background(), "/report_status", map[string]int{"load": load}, func(ClientContext) {}); err != nil {
+		t.Fatalf("report status failed: %v", err)
+	}
+}
+
+func connectTestNode(t *testing.T, gatewayPort int) string {
+	t.Helper()
+	node, err := requestTestNode(gatewayPort)
+	if err != nil {
+		t.Fatalf("request node failed: %v", err)
+	}
+	return node
+}
+
+func requestTestNode(gatewayPort int) (string, error) {
+	config := NewDefaultClientConfig()
+	config.Port = gatewayPort
+	config.DirectConnect = false
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var node string
+	err := client.Request(ctx, "/node", nil, func(ctx ClientContext, name string) {
+		node = name
+	})
+	return node, err
+}
+
+func TestClusterLeastLoad(t *testing.T) {
+	startTestServer(t, 22201, func(config *ServerConfig) {
+		config.PeerTimeout = 500 * time.Millisecond
+	})
+	startTestServer(t, 22202, nil)
+	startTestServer(t, 22203, nil)
+
+	if node := connectTestNode(t, 22201); node != "node-22201" {
+		t.Fatalf("expected gateway without peers, got %s", node)
+	}
+
+	busy := joinTestNetwork(t, 22201, 22202, 10)
+	joinTestNetwork(t, 22201, 22203, 1)
+	if node := connectTestNode(t, 22201); node != "node-22203" {
+		t.Fatalf("expected least loaded node-22203, got %s", node)
+	}
+
+	// node-22203 停止上报后过期 只剩 node-22202 可选
+	time.Sleep(600 * time.Millisecond)
+	reportTestLoad(t, busy, 10)
+	if node := connectTestNode(t, 22201); node != "node-22202" {
+		t.Fatalf("expected live node-22202, got %s", node)
+	}
+}
+
+func TestClusterDirectConnect(t *testing.T) {
+	startTestServer(t, 22211, nil)
+	startTestServer(t, 22212, nil)
+	joinTestNetwork(t, 22211, 22212, 0)
+
+	config := NewDefaultClientConfig()
+	config.Port = 22211
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+	var node string
+	if err := client.Request(context.Background(), "/node", nil, func(ctx ClientContext, name string) {
+		node = name
+	}); err != nil {
+		t.Fatalf("request node failed: %v", err)
+	}
+	if node != "node-22211" {
+		t.Fatalf("expected direct connection to gateway, got %s", node)
+	}
+}
+
+func TestClusterRoundRobin(t *testing.T) {
+	startTestServer(t, 22221, func(config *ServerConfig) {
+		config.Balancer = NewRoundRobinBalancer()
+	})
+	startTestServer(t, 22222, nil)
+	startTestServer(t, 22223, nil)
+	joinTestNetwork(t, 22221, 22222, 0)
+	joinTestNetwork(t, 22221, 22223, 100)
+
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		seen[connectTestNode(t, 22221)]++
+	}
+	if seen["node-22222"] != 2 || seen["node-22223"] != 2 {
+		t.Fatalf("expected even distribution, got %v", seen)
+	}
+}
+
+func TestWeightedRandomBalancer(t *testing.T) {
+	balancer := NewWeightedRandomBalancer()
+	candidates := []Status{{ID: "idle", Load: 0}, {ID: "busy", Load: 999}}
+	idle := 0
+	for i := 0; i < 1000; i++ {
+		status, ok := balancer.Pick(candidates)
+		if !ok {
+			t.Fatal("pick failed")
+		}
+		if status.ID == "idle" {
+			idle++
+		}
+	}
+	if idle < 950 {
+		t.Fatalf("expected idle node to be picked most of the time, got %d/1000", idle)
+	}
+	if _, ok := balancer.Pick(nil); ok {
+		t.Fatal("expected no pick from empty candidates")
+	}
+}
+
+func TestClusterJoinNetwork(t *testing.T) {
+	startTestServer(t, 22231, func(config *ServerConfig) {
+		config.RemoveInterval = 50 * time.Millisecond
+		config.PeerTimeout = 300 * time.Millisecond
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	config := NewDefaultServerConfig()
+	config.Addr = "127.0.0.1"
+	config.Port = 22232
+	config.NetworkSignKey = testSignKey
+	config.JoinNetwork = "127.0.0.1:22231"
+	config.ReportInterval = 100 * time.Millisecond
+	peer := NewServer(config)
+	if err := peer.Handle("/node", func(ctx ServerContext) (string, error) {
+		return "node-22232", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = peer.ListenAndServe(ctx) }()
+	defer cancel()
+
+	waitTestNode(t, 22231, "node-22232")
+
+	// 节点下线后 网关应将其移除并回退到自身
+	cancel()
+	waitTestNode(t, 22231, "node-22231")
+}
+
+func TestClusterJoinNetworkUnspecifiedAddr(t *testing.T) {
+	startTestServer(t, 22441, nil)
+	// 监听 0.0.0.0 且未设置 AdvertiseAddr 时 节点不应以不可达的地址加入网络
+	startTestServer(t, 22442, func(config *ServerConfig) {
+		config.Addr = "0.0.0.0"
+		config.JoinNetwork = "127.0.0.1:22441"
+		config.ReportInterval = 50 * time.Millisecond
+	})
+	time.Sleep(300 * time.Millisecond)
+	if node, err := requestTestNode(22441); err != nil || node != "node-22441" {
+		t.Fatalf("expected node-22441, got %s, %v", node, err)
+	}
+
+	startTestServer(t, 22443, func(config *ServerConfig) {
+		config.Addr = "0.0.0.0"
+		config.AdvertiseAddr = "127.0.0.1:22443"
+		config.JoinNetwork = "127.0.0.1:22441"
+		config.ReportInterval = 50 * time.Millisecond
+	})
+	waitTestNode(t, 22441, "node-22443")
+}
+
+func waitTestNode(t *testing.T, gatewayPort int, want string) {
+	t.Helper()
+	var node string
+	for i := 0; i < 50; i++ {
+		// 节点上下线期间可能被引导到正在关闭的节点 忽略错误重试
+		if node, _ = requestTestNode(gatewayPort); node == want {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("expected %s, got %s", want, node)
+}
+
+func connectTestSystem(t *testing.T, port int) Client {
+	t.Helper()
+	config := NewDefaultClientConfig()
+	config.Port = port
+	config.Mode = ModeServer
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect system failed: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestSystemChannelAuth(t *testing.T) {
+	startTestServer(t, 22381, nil)
+	client := connectTestSystem(t, 22381)
+	report := map[string]int{"load": 1}
+
+	if err := client.Request(context.Background(), "/report_status", report, func(ClientContext) {}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unauthorized before join, got %v", err)
+	}
+	if _, err := Call[bool, string](context.Background(), client, "/get_low_load_server_addr", true); err != nil {
+		t.Fatalf("gateway lookup should stay public: %v", err)
+	}
+	if err := joinTestSystem(client, "127.0.0.1:1", "wrong-key"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected invalid sign, got %v", err)
+	}
+
+	// 挑战值只能使用一次 重放同一加入请求失败
+	nonce, err := Call[any, string](context.Background(), client, "/challenge", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, timestamp := "127.0.0.1:1", time.Now().Unix()
+	join := map[string]any{"url": url, "timestamp": timestamp, "nonce": nonce, "sign": core.SignChallenge(url, timestamp, nonce, testSignKey)}
+	if err := client.Request(context.Background(), "/join", join, func(ClientContext) {}); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	if err := client.Request(context.Background(), "/join", join, func(ClientContext) {}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected replay rejected, got %v", err)
+	}
+	if err := client.Request(context.Background(), "/report_status", report, func(ClientContext) {}); err != nil {
+		t.Fatalf("report after join failed: %v", err)
+	}
+
+	// 过期时间戳被拒绝
+	other := connectTestSystem(t, 22381)
+	nonce, err = Call[any, string](context.Background(), other, "/challenge", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp = time.Now().Add(-time.Hour).Unix()
+	join = map[string]any{"url": url, "timestamp": timestamp, "nonce": nonce, "sign": core.SignChallenge(url, timestamp, nonce, testSignKey)}
+	if err := other.Request(context.Background(), "/join", join, func(ClientContext) {}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected expired sign rejected, got %v", err)
+	}
+}
+
+func TestSystemSeparateAddr(t *testing.T) {
+	startTestServer(t, 22382, func(config *ServerConfig) {
+		config.SystemAddr = "127.0.0.1:22383"
+	})
+	waitTestPort(t, 22383)
+
+	// 公网端口只提供网关查询
+	public := connectTestSystem(t, 22382)
+	if _, err := Call[any, string](context.Background(), public, "/challenge", nil); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected challenge unavailable on public port, got %v", err)
+	}
+	if node := connectTestNode(t, 22382); node != "node-22382" {
+		t.Fatalf("expected node-22382, got %s", node)
+	}
+
+	internal := connectTestSystem(t, 22383)
+	if err := joinTestSystem(internal, "127.0.0.1:22384", testSignKey); err != nil {
+		t.Fatalf("join on internal port failed: %v", err)
+	}
+}
+
+func waitTestPort(t *testing.T, port int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			_ = conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("port %d not ready", port)
+}
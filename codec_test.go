@@ -0,0 +1,90 @@
+package feng
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zmhuanf/feng/internal/testpb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProtoCodecRoundTrip(t *testing.T) {
+	server := startTestServer(t, 22271, func(config *ServerConfig) {
+		config.Codec = NewProtoCodec()
+	})
+	_ = server.Handle("/level_up", func(ctx ServerContext, player *testpb.Player) (*testpb.Player, error) {
+		if err := ctx.User().Push("/notice", &testpb.Player{Name: player.Name}); err != nil {
+			return nil, err
+		}
+		player.Level++
+		player.Items = append(player.Items, "sword")
+		return player, nil
+	})
+	_ = server.Handle("/flag", func(ctx ServerContext, flag bool) (string, error) {
+		if flag {
+			return "on", nil
+		}
+		return "off", nil
+	})
+	_ = server.Handle("/double", func(ctx ServerContext, n int32) (int32, error) {
+		return n * 2, nil
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22271
+	config.Codec = NewProtoCodec()
+	client := NewClient(config)
+	notice := make(chan string, 1)
+	if err := client.Handle("/notice", func(ctx ClientContext, player *testpb.Player) {
+		notice <- player.Name
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	var resp *testpb.Player
+	req := &testpb.Player{Name: "feng", Level: 17, Items: []string{"shield"}}
+	if err := client.Request(context.Background(), "/level_up", req, func(ctx ClientContext, player *testpb.Player) {
+		resp = player
+	}); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	want := &testpb.Player{Name: "feng", Level: 18, Items: []string{"shield", "sword"}}
+	if !proto.Equal(resp, want) {
+		t.Fatalf("expected %v, got %v", want, resp)
+	}
+	select {
+	case name := <-notice:
+		if name != "feng" {
+			t.Fatalf("unexpected notice %q", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notice not received")
+	}
+
+	var flag string
+	if err := client.Request(context.Background(), "/flag", true, func(ctx ClientContext, s string) { flag = s }); err != nil {
+		t.Fatalf("flag request failed: %v", err)
+	}
+	if flag != "on" {
+		t.Fatalf("expected on, got %q", flag)
+	}
+	var doubled int32
+	if err := client.Request(context.Background(), "/double", int32(21), func(ctx ClientContext, n int32) { doubled = n }); err != nil {
+		t.Fatalf("double request failed: %v", err)
+	}
+	if doubled != 42 {
+		t.Fatalf("expected 42, got %d", doubled)
+	}
+}
+
+func TestProtoCodecRejectsPlainStruct(t *testing.T) {
+	type A struct{ Name string }
+	if _, err := NewProtoCodec().Marshal(A{Name: "feng"}); err == nil {
+		t.Fatal("expected error for non proto struct")
+	}
+}
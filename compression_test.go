@@ -0,0 +1,219 @@
+package feng
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zmhuanf/feng/internal/protocol"
+)
+
+type testSnapshot struct {
+	Players []testSnapshotPlayer `json:"players"`
+}
+
+type testSnapshotPlayer struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	X     float64  `json:"x"`
+	Y     float64  `json:"y"`
+	Items []string `json:"items"`
+}
+
+// newTestSnapshot 构造一个约 30KB 的房间快照
+func newTestSnapshot() []byte {
+	var snapshot testSnapshot
+	for i := 0; i < 150; i++ {
+		snapshot.Players = append(snapshot.Players, testSnapshotPlayer{
+			ID:    fmt.Sprintf("player-%04d", i),
+			Name:  fmt.Sprintf("name-%d", i%17),
+			X:     float64(i) * 1.5,
+			Y:     float64(i%13) * 2.25,
+			Items: []string{"sword", "shield", "potion"},
+		})
+	}
+	data, _ := json.Marshal(snapshot)
+	return data
+}
+
+func startCompressionServer(t testing.TB, port int, deflate bool, compressor Compressor) {
+	server := startTestServer(t, port, func(config *ServerConfig) {
+		config.EnableCompression = deflate
+		config.Compressor = compressor
+	})
+	_ = server.Handle("/snapshot", func(ctx ServerContext, data []byte) ([]byte, error) {
+		return data, nil
+	})
+}
+
+func connectCompressionClient(t testing.TB, port int, deflate bool, compressor Compressor) Client {
+	config := NewDefaultClientConfig()
+	config.Port = port
+	config.EnableCompression = deflate
+	config.Compressor = compressor
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	return client
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	startCompressionServer(t, 22281, true, NewZstdCompressor())
+
+	header := http.Header{}
+	header.Set(protocol.HeaderCompression, "snappy, zstd")
+	dialer := websocket.Dialer{Subprotocols: []string{protocol.Subprotocol}}
+	conn, resp, err := dialer.Dial("ws://127.0.0.1:22281/game", header)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	_ = conn.Close()
+	if got := resp.Header.Get(protocol.HeaderCompression); got != "zstd" {
+		t.Fatalf("expected zstd to be selected, got %q", got)
+	}
+
+	snapshot := newTestSnapshot()
+	for _, compressor := range []Compressor{NewZstdCompressor(), NewSnappyCompressor(), nil} {
+		client := connectCompressionClient(t, 22281, compressor != nil, compressor)
+		var resp []byte
+		if err := client.Request(context.Background(), "/snapshot", snapshot, func(ctx ClientContext, data []byte) { resp = data }); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if !bytes.Equal(resp, snapshot) {
+			t.Fatalf("snapshot mismatch with compressor %v", compressor)
+		}
+		_ = client.Close()
+	}
+}
+
+func BenchmarkCompression(b *testing.B) {
+	snapshot := newTestSnapshot()
+	cases := []struct {
+		name       string
+		deflate    bool
+		compressor func() Compressor
+	}{
+		{name: "none"},
+		{name: "deflate", deflate: true},
+		{name: "zstd", compressor: NewZstdCompressor},
+		{name: "snappy", compressor: NewSnappyCompressor},
+	}
+	for i, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			var compressor Compressor
+			if c.compressor != nil {
+				compressor = c.compressor()
+				compressed, _ := compressor.Compress(snapshot)
+				b.ReportMetric(float64(len(compressed))/float64(len(snapshot)), "ratio")
+			}
+			port := 22291 + i
+			startCompressionServer(b, port, c.deflate, compressor)
+			client := connectCompressionClient(b, port, c.deflate, compressor)
+			defer client.Close()
+
+			b.SetBytes(int64(len(snapshot)))
+			b.ResetTimer()
+			for b.Loop() {
+				if err := client.Request(context.Background(), "/snapshot", snapshot, func(ctx ClientContext, data []byte) {}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressionBomb(t *testing.T) {
+	for i, compressor := range []Compressor{NewZstdCompressor(), NewSnappyCompressor()} {
+		port := 22282 + i
+		received := make(chan int, 1)
+		server := startTestServer(t, port, func(config *ServerConfig) {
+			config.Compressor = compressor
+			config.MaxMessageSize = 64 << 10
+		})
+		_ = server.Handle("/upload", func(ctx ServerContext, data []byte) error {
+			received <- len(data)
+			return nil
+		})
+
+		header := http.Header{}
+		header.Set(protocol.HeaderCompression, compressor.Name())
+		dialer := websocket.Dialer{Subprotocols: []string{protocol.Subprotocol}}
+		conn, _, err := dialer.Dial(fmt.Sprintf("ws://127.0.0.1:%d/game", port), header)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		defer conn.Close()
+
+		// 压缩后远小于 MaxMessageSize 解压后为 1 MiB
+		bomb, _ := compressor.Compress(make([]byte, 1<<20))
+		if len(bomb) >= 64<<10 {
+			t.Fatalf("%s bomb too large: %d", compressor.Name(), len(bomb))
+		}
+		msg := &protocol.Message{ID: 1, Route: "/upload", Type: protocol.MessageTypeRequest, Data: bomb, Compressed: true}
+		if err := conn.WriteMessage(websocket.BinaryMessage, protocol.Encode(msg)); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+					t.Fatalf("%s bomb did not close the connection", compressor.Name())
+				}
+				break
+			}
+		}
+		select {
+		case size := <-received:
+			t.Fatalf("%s bomb reached the handler with %d bytes", compressor.Name(), size)
+		default:
+		}
+	}
+}
+
+func TestDeflateBomb(t *testing.T) {
+	received := make(chan int, 1)
+	server := startTestServer(t, 22284, func(config *ServerConfig) {
+		config.EnableCompression = true
+		config.MaxMessageSize = 64 << 10
+	})
+	_ = server.Handle("/upload", func(ctx ServerContext, data []byte) error {
+		received <- len(data)
+		return nil
+	})
+
+	dialer := websocket.Dialer{Subprotocols: []string{protocol.Subprotocol}, EnableCompression: true}
+	conn, _, err := dialer.Dial("ws://127.0.0.1:22284/game", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// 经 permessage-deflate 压缩后线上只有几 KiB 解压后为 1 MiB
+	msg := &protocol.Message{ID: 1, Route: "/upload", Type: protocol.MessageTypeRequest, Data: make([]byte, 1<<20)}
+	if err := conn.WriteMessage(websocket.BinaryMessage, protocol.Encode(msg)); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				t.Fatal("deflate bomb did not close the connection")
+			}
+			if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+				t.Fatalf("expected close 1009, got %v", err)
+			}
+			break
+		}
+	}
+	select {
+	case size := <-received:
+		t.Fatalf("deflate bomb reached the handler with %d bytes", size)
+	default:
+	}
+}
@@ -0,0 +1,15 @@
+package feng
+
+import "github.com/zmhuanf/feng/internal/core"
+
+type Compressor = core.Compressor
+
+var ErrDecompressedTooLarge = core.ErrDecompressedTooLarge
+
+func NewZstdCompressor() Compressor {
+	return core.NewZstdCompressor()
+}
+
+func NewSnappyCompressor() Compressor {
+	return core.NewSnappyCompressor()
+}
@@ -5,6 +5,27 @@ import "github.com/zmhuanf/feng/internal/core"
 type ServerConfig = core.ServerConfig
 type ClientConfig = core.ClientConfig
 type Mode = core.Mode
+type DispatchMode = core.DispatchMode
+type DuplicateLoginPolicy = core.DuplicateLoginPolicy
+type SendQueuePolicy = core.SendQueuePolicy
+
+const (
+	DispatchOrdered         = core.DispatchOrdered
+	DispatchOrderedPerRoute = core.DispatchOrderedPerRoute
+	DispatchConcurrent      = core.DispatchConcurrent
+)
+
+const (
+	DuplicateReject   = core.DuplicateReject
+	DuplicateKick     = core.DuplicateKick
+	DuplicateTakeOver = core.DuplicateTakeOver
+)
+
+const (
+	SendQueueDropOldest = core.SendQueueDropOldest
+	SendQueueCoalesce   = core.SendQueueCoalesce
+	SendQueueDisconnect = core.SendQueueDisconnect
+)
 
 const (
 	ModeClient = core.ModeClient
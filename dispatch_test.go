@@ -0,0 +1,171 @@
+package feng
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func connectDispatchClient(t *testing.T, port int, setup func(*ClientConfig)) Client {
+	t.Helper()
+	config := NewDefaultClientConfig()
+	config.Port = port
+	if setup != nil {
+		setup(&config)
+	}
+	client := NewClient(config)
+	_ = client.Handle("/question", func(ctx ClientContext, data string) (string, error) {
+		return data + "-pong", nil
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestNestedRequest(t *testing.T) {
+	modes := []struct {
+		name string
+		mode DispatchMode
+	}{
+		{"ordered", DispatchOrdered},
+		{"per-route", DispatchOrderedPerRoute},
+		{"concurrent", DispatchConcurrent},
+	}
+	for i, m := range modes {
+		mode := m.mode
+		t.Run(m.name, func(t *testing.T) {
+			port := 22301 + i
+			server := startTestServer(t, port, func(config *ServerConfig) {
+				config.DispatchMode = mode
+			})
+			_ = server.Handle("/ask", func(ctx ServerContext) (string, error) {
+				var answer string
+				err := ctx.User().Request(context.Background(), "/question", "ping", func(ctx ServerContext, data string) { answer = data })
+				return answer, err
+			})
+			client := connectDispatchClient(t, port, func(config *ClientConfig) {
+				config.DispatchMode = mode
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			var resp string
+			if err := client.Request(ctx, "/ask", nil, func(ctx ClientContext, data string) { resp = data }); err != nil {
+				t.Fatalf("nested request failed: %v", err)
+			}
+			if resp != "ping-pong" {
+				t.Fatalf("expected ping-pong, got %q", resp)
+			}
+		})
+	}
+}
+
+// startDispatchServer 注册 /slow 和 /fast 两个路由 /slow 在 release 关闭前不返回
+func startDispatchServer(t *testing.T, port int, mode DispatchMode, release chan struct{}) (*[]string, *sync.Mutex) {
+	t.Helper()
+	server := startTestServer(t, port, func(config *ServerConfig) {
+		config.DispatchMode = mode
+	})
+	var order []string
+	var lock sync.Mutex
+	record := func(name string) {
+		lock.Lock()
+		order = append(order, name)
+		lock.Unlock()
+	}
+	_ = server.Handle("/slow", func(ctx ServerContext, name string) error {
+		select {
+		case <-release:
+		case <-time.After(300 * time.Millisecond):
+		}
+		record(name)
+		return nil
+	})
+	_ = server.Handle("/fast", func(ctx ServerContext, name string) error {
+		record(name)
+		return nil
+	})
+	return &order, &lock
+}
+
+func sendDispatchMessages(t *testing.T, client Client, routes ...string) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i, route := range routes {
+		wg.Add(1)
+		if err := client.RequestAsync(route, fmt.Sprintf("%s%d", route, i), func(ClientContext) { wg.Done() }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestDispatchOrdered(t *testing.T) {
+	order, lock := startDispatchServer(t, 22311, DispatchOrdered, make(chan struct{}))
+	client := connectDispatchClient(t, 22311, nil)
+
+	sendDispatchMessages(t, client, "/slow", "/fast")
+	lock.Lock()
+	defer lock.Unlock()
+	if strings.Join(*order, ",") != "/slow0,/fast1" {
+		t.Fatalf("expected strict order, got %v", *order)
+	}
+}
+
+func TestDispatchOrderedPerRoute(t *testing.T) {
+	release := make(chan struct{})
+	order, lock := startDispatchServer(t, 22312, DispatchOrderedPerRoute, release)
+	client := connectDispatchClient(t, 22312, nil)
+
+	go func() {
+		// /fast 不等待 /slow 完成 完成后放行 /slow
+		for {
+			lock.Lock()
+			n := len(*order)
+			lock.Unlock()
+			if n >= 2 {
+				close(release)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	sendDispatchMessages(t, client, "/slow", "/fast", "/fast", "/slow")
+	lock.Lock()
+	defer lock.Unlock()
+	if strings.Join(*order, ",") != "/fast1,/fast2,/slow0,/slow3" {
+		t.Fatalf("expected per-route order, got %v", *order)
+	}
+}
+
+func TestDispatchConcurrentLimit(t *testing.T) {
+	release := make(chan struct{})
+	server := startTestServer(t, 22313, func(config *ServerConfig) {
+		config.DispatchMode = DispatchConcurrent
+		config.MaxInFlight = 1
+	})
+	_ = server.Handle("/block", func(ctx ServerContext) error {
+		<-release
+		return nil
+	})
+	client := connectDispatchClient(t, 22313, nil)
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- client.Request(context.Background(), "/block", nil, func(ClientContext) {})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	err := client.Request(context.Background(), "/block", nil, func(ClientContext) {})
+	if err == nil || err.Error() != ErrBusy.Error() {
+		t.Fatalf("expected busy error, got %v", err)
+	}
+	close(release)
+	if err := <-blocked; err != nil {
+		t.Fatalf("blocked request failed: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package feng
+
+import "github.com/zmhuanf/feng/internal/core"
+
+type Error = core.Error
+type ErrorCode = core.ErrorCode
+type MulticastError = core.MulticastError
+
+const (
+	CodeUnknown        = core.CodeUnknown
+	CodeInternal       = core.CodeInternal
+	CodeNotFound       = core.CodeNotFound
+	CodeTimeout        = core.CodeTimeout
+	CodeValidation     = core.CodeValidation
+	CodeUnauthorized   = core.CodeUnauthorized
+	CodeBusy           = core.CodeBusy
+	CodeKicked         = core.CodeKicked
+	CodeDuplicateLogin = core.CodeDuplicateLogin
+	CodeRateLimited    = core.CodeRateLimited
+	CodeRoomFull       = core.CodeRoomFull
+	CodeRoomClosed     = core.CodeRoomClosed
+	CodeRoomPassword   = core.CodeRoomPassword
+	CodeConnectionLost = core.CodeConnectionLost
+	CodeApplication    = core.CodeApplication
+)
+
+func NewError(code ErrorCode, message string) *Error {
+	return core.NewError(code, message)
+}
+
+var (
+	ErrConnectionLost = core.ErrConnectionLost
+	ErrInternal       = core.ErrInternal
+	ErrBusy           = core.ErrBusy
+	ErrNotFound       = core.ErrNotFound
+	ErrTimeout        = core.ErrTimeout
+	ErrUnauthorized   = core.ErrUnauthorized
+	ErrKicked         = core.ErrKicked
+	ErrDuplicateLogin = core.ErrDuplicateLogin
+	ErrRateLimited    = core.ErrRateLimited
+	ErrRoomFull       = core.ErrRoomFull
+	ErrRoomClosed     = core.ErrRoomClosed
+	ErrRoomPassword   = core.ErrRoomPassword
+)
@@ -0,0 +1,96 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zmhuanf/feng/internal/protocol"
+)
+
+func TestStructuredErrors(t *testing.T) {
+	server := startTestServer(t, 22321, nil)
+	_ = server.Handle("/buy", func(ctx ServerContext) error {
+		return Error{Code: 1001, Message: "not enough gold", Details: map[string]string{"need": "10"}}
+	})
+	_ = server.Handle("/plain", func(ctx ServerContext) error {
+		return errors.New("plain failure")
+	})
+	_ = server.Handle("/typed", func(ctx ServerContext, req testLoginReq) error {
+		return nil
+	})
+	_ = HandleFunc(server, "/typed_func", func(ctx ServerContext, req testLoginReq) (string, error) {
+		return req.Name, nil
+	})
+	release := make(chan struct{})
+	defer close(release)
+	_ = server.Handle("/block", func(ctx ServerContext) error {
+		<-release
+		return nil
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22321
+	config.Timeout = 200 * time.Millisecond
+	config.DispatchMode = DispatchConcurrent
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+	request := func(route string) error {
+		return client.Request(context.Background(), route, nil, func(ClientContext) {})
+	}
+
+	var e *Error
+	if err := request("/buy"); !errors.As(err, &e) || e.Code != 1001 || e.Message != "not enough gold" || e.Details["need"] != "10" {
+		t.Fatalf("unexpected application error: %#v", err)
+	}
+	if err := request("/plain"); !errors.As(err, &e) || e.Code != CodeApplication || e.Message != "plain failure" {
+		t.Fatalf("expected CodeApplication, got %#v", err)
+	}
+	// 无法解码的载荷属于非法输入 不应与处理函数的错误混淆
+	for _, route := range []string{"/typed", "/typed_func"} {
+		err := client.Request(context.Background(), route, "{not json", func(ClientContext) {})
+		if !errors.As(err, &e) || e.Code != CodeValidation {
+			t.Fatalf("expected CodeValidation for malformed %s payload, got %#v", route, err)
+		}
+	}
+	if err := request("/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %#v", err)
+	}
+	if err := request("/block"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %#v", err)
+	}
+}
+
+func TestLegacyErrorEnvelope(t *testing.T) {
+	startTestServer(t, 22322, nil)
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:22322/game", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(protocol.LegacyMessage{Route: "/missing", ID: "x", Type: protocol.MessageTypeRequest}); err != nil {
+		t.Fatal(err)
+	}
+	var back protocol.LegacyMessage
+	if err := conn.ReadJSON(&back); err != nil {
+		t.Fatal(err)
+	}
+	// 旧版客户端仍从 data 读取错误描述
+	if back.Success || back.Data != "route not found" || back.Code != uint32(CodeNotFound) {
+		t.Fatalf("unexpected legacy error: %+v", back)
+	}
+
+	msg := &protocol.Message{ID: 5, Type: protocol.MessageTypeRequestBack, Code: 1001, Details: map[string]string{"field": "name"}, Data: []byte("bad")}
+	decoded, err := protocol.Decode(protocol.Encode(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Code != 1001 || decoded.Details["field"] != "name" || string(decoded.Data) != "bad" {
+		t.Fatalf("error frame round trip mismatch: %+v", decoded)
+	}
+}
@@ -0,0 +1,36 @@
+package feng
+
+import (
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/router"
+)
+
+// HandleFunc 注册强类型的服务端处理函数 签名在编译期检查 调用时不经过反射
+func HandleFunc[Req, Resp any](server Server, route string, handler func(ServerContext, Req) (Resp, error)) error {
+	return server.Handle(route, router.Func(func(ctx any, data []byte, codec core.Codec) ([]byte, error) {
+		req, err := router.Decode[Req](data, codec)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := handler(ctx.(ServerContext), req)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(resp)
+	}))
+}
+
+// HandleClientFunc 注册强类型的客户端处理函数
+func HandleClientFunc[Req, Resp any](client Client, route string, handler func(ClientContext, Req) (Resp, error)) error {
+	return client.Handle(route, router.Func(func(ctx any, data []byte, codec core.Codec) ([]byte, error) {
+		req, err := router.Decode[Req](data, codec)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := handler(ctx.(ClientContext), req)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(resp)
+	}))
+}
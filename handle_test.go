@@ -0,0 +1,96 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/router"
+)
+
+func TestHandleFunc(t *testing.T) {
+	server := startTestServer(t, 22341, nil)
+	err := HandleFunc(server, "/login", func(ctx ServerContext, req testLoginReq) (testLoginResp, error) {
+		if req.Name == "" {
+			return testLoginResp{}, NewError(CodeValidation, "empty name")
+		}
+		return testLoginResp{ID: "u-" + req.Name, Level: 1}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = HandleFunc(server, "/room/:id/echo", func(ctx ServerContext, msg string) (string, error) {
+		return ctx.Param("id") + ":" + msg, nil
+	})
+	_ = HandleFunc(server, "/ask", func(ctx ServerContext, req *testLoginReq) (string, error) {
+		return CallUser[string, string](context.Background(), ctx.User(), "/name", req.Name)
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22341
+	client := NewClient(config)
+	_ = HandleClientFunc(client, "/name", func(ctx ClientContext, name string) (string, error) {
+		return "client-" + name, nil
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := Call[testLoginReq, testLoginResp](context.Background(), client, "/login", testLoginReq{Name: "feng"})
+	if err != nil || resp.ID != "u-feng" {
+		t.Fatalf("unexpected login response: %+v %v", resp, err)
+	}
+	if _, err := Call[testLoginReq, testLoginResp](context.Background(), client, "/login", testLoginReq{}); !errors.Is(err, NewError(CodeValidation, "")) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if echo, err := Call[string, string](context.Background(), client, "/room/7/echo", "hi"); err != nil || echo != "7:hi" {
+		t.Fatalf("unexpected echo %q %v", echo, err)
+	}
+	if name, err := Call[testLoginReq, string](context.Background(), client, "/ask", testLoginReq{Name: "feng"}); err != nil || name != "client-feng" {
+		t.Fatalf("unexpected name %q %v", name, err)
+	}
+	// 空载荷与反射路径一样交给 codec 解码失败 指针参数不会以 nil 传入处理函数
+	if _, err := client.RequestRaw(context.Background(), "/ask", nil); err == nil || errors.Is(err, ErrInternal) {
+		t.Fatalf("expected decode error for empty payload, got %v", err)
+	}
+}
+
+func benchmarkHandler(b *testing.B, fn any) {
+	codec := core.NewJSONCodec()
+	ctx := core.NewServerContext(nil, nil)
+	data, _ := codec.Marshal(testLoginReq{Name: "feng"})
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := router.Call(fn, ctx, data, codec); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHandlerReflect(b *testing.B) {
+	benchmarkHandler(b, func(ctx ServerContext, req testLoginReq) (testLoginResp, error) {
+		return testLoginResp{ID: req.Name}, nil
+	})
+}
+
+func BenchmarkHandlerGeneric(b *testing.B) {
+	server := NewServer(NewDefaultServerConfig())
+	var fn any
+	// 通过一个记录处理函数的服务端取出 HandleFunc 生成的 router.Func
+	_ = HandleFunc(&recordServer{Server: server, record: &fn}, "/login", func(ctx ServerContext, req testLoginReq) (testLoginResp, error) {
+		return testLoginResp{ID: req.Name}, nil
+	})
+	benchmarkHandler(b, fn)
+}
+
+type recordServer struct {
+	Server
+	record *any
+}
+
+func (s *recordServer) Handle(route string, handler any) error {
+	*s.record = handler
+	return s.Server.Handle(route, handler)
+}
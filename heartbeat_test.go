@@ -0,0 +1,62 @@
+package feng
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHeartbeatRemovesDeadConnection(t *testing.T) {
+	server := startTestServer(t, 22251, func(config *ServerConfig) {
+		config.PingInterval = 50 * time.Millisecond
+		config.PongTimeout = 50 * time.Millisecond
+	})
+
+	// 不读取数据的连接不会回复 pong 相当于半开连接
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:22251/game", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	waitTestCondition(t, func() bool { return len(server.Users()) == 1 })
+	// 连接不会自动创建房间
+	if len(server.Rooms()) != 0 {
+		t.Fatalf("expected no room, got %d", len(server.Rooms()))
+	}
+	waitTestCondition(t, func() bool { return len(server.Users()) == 0 })
+}
+
+func TestHeartbeatRTT(t *testing.T) {
+	server := startTestServer(t, 22252, func(config *ServerConfig) {
+		config.PingInterval = 20 * time.Millisecond
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22252
+	config.PingInterval = 20 * time.Millisecond
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	waitTestCondition(t, func() bool { return client.RTT() > 0 })
+	waitTestCondition(t, func() bool {
+		users := server.Users()
+		return len(users) == 1 && users[0].RTT() > 0
+	})
+}
+
+func waitTestCondition(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
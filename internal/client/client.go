@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"reflect"
 	"sync"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/zmhuanf/feng/internal/core"
 	"github.com/zmhuanf/feng/internal/pending"
 	"github.com/zmhuanf/feng/internal/protocol"
@@ -21,6 +23,9 @@ type channel struct {
 	pending *pending.Store
 	cancel  context.CancelFunc
 	closed  bool
+	done    chan struct{}
+	url     string
+	token   string
 	lock    sync.RWMutex
 }
 
@@ -43,6 +48,7 @@ func newChannel(config core.ClientConfig) *channel {
 	return &channel{
 		router:  router.New(reflect.TypeFor[core.ClientContext]()),
 		pending: pending.New(config.Timeout),
+		done:    make(chan struct{}),
 	}
 }
 
@@ -74,10 +80,12 @@ func (c *Client) connect(ctx context.Context, addr string, needNew bool) error {
 		if err := c.connectSystem(ctx, fmt.Sprintf("%s://%s/system", proto, addr)); err != nil {
 			return err
 		}
-		var serverAddr string
-		if err := c.request(ctx, "/get_low_load_server_addr", needNew, func(_ core.ClientContext, addr string) {
-			serverAddr = addr
-		}, true); err != nil {
+		data, err := c.requestRaw(ctx, "/get_low_load_server_addr", needNew, true)
+		if err != nil {
+			return err
+		}
+		serverAddr, err := router.Decode[string](data, c.config.Codec)
+		if err != nil {
 			return err
 		}
 		if serverAddr == "" {
@@ -100,24 +108,99 @@ func (c *Client) connectUser(ctx context.Context, url string) error {
 }
 
 func (c *Client) connectChannel(ctx context.Context, ch *channel, url string) error {
+	_, err := c.dialChannel(ctx, ch, url)
+	return err
+}
+
+// statusCodes 升级被拒绝时 HTTP 状态码对应的错误码
+var statusCodes = map[int]core.ErrorCode{
+	http.StatusUnauthorized:       core.CodeUnauthorized,
+	http.StatusForbidden:          core.CodeUnauthorized,
+	http.StatusConflict:           core.CodeDuplicateLogin,
+	http.StatusServiceUnavailable: core.CodeBusy,
+}
+
+func statusCode(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// dialChannel 建立连接并启动读循环 返回服务器是否恢复了原会话
+func (c *Client) dialChannel(ctx context.Context, ch *channel, url string) (bool, error) {
 	ch.lock.Lock()
 	defer ch.lock.Unlock()
 	if ch.closed {
-		return errors.New("client is closed")
+		return false, errors.New("client is closed")
+	}
+	header := http.Header{}
+	if ch.token != "" {
+		header.Set(protocol.HeaderResumeToken, ch.token)
+	}
+	if c.config.Compressor != nil {
+		header.Set(protocol.HeaderCompression, c.config.Compressor.Name())
+	}
+	if ch == c.user && c.config.Credentials != "" && !c.config.AuthHandshake {
+		header.Set("Authorization", c.config.Credentials)
 	}
-	conn, err := transport.Dial(url, c.config.Codec)
+	conn, resp, err := transport.Dial(url, header, c.config.EnableCompression)
 	if err != nil {
-		return err
+		if code, ok := statusCodes[statusCode(resp)]; ok {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			return false, core.NewError(code, string(body))
+		}
+		return false, err
+	}
+	conn.SetCompression(transport.NegotiateCompressor(resp.Header.Get(protocol.HeaderCompression), c.config.Compressor), c.config.CompressThreshold)
+	conn.KeepAlive(c.config.PingInterval, c.config.PongTimeout)
+	if ch == c.user && c.config.AuthHandshake {
+		if err := c.handshake(ch, conn); err != nil {
+			_ = conn.Close()
+			return false, err
+		}
+	}
+	if err := conn.SendRouteTable(ch.router.Table()); err != nil {
+		_ = conn.Close()
+		return false, err
+	}
+	// 网关重定向到其他节点时 先关闭旧连接
+	if ch.cancel != nil {
+		ch.cancel()
+	}
+	if ch.conn != nil {
+		_ = ch.conn.Close()
 	}
 	readCtx, cancel := context.WithCancel(ctx)
 	ch.conn = conn
 	ch.cancel = cancel
-	go c.readLoop(readCtx, ch)
+	ch.url = url
+	ch.token = resp.Header.Get(protocol.HeaderResumeToken)
+	go c.readLoop(readCtx, ch, conn)
+	return resp.Header.Get(protocol.HeaderResumed) == "true", nil
+}
+
+// handshake 发送首条认证消息并等待服务器的认证结果
+func (c *Client) handshake(ch *channel, conn *transport.Conn) error {
+	id := ch.pending.NextID()
+	if err := conn.Send(&protocol.Message{ID: id, Route: protocol.RouteAuth, Type: protocol.MessageTypeRequest, Data: []byte(c.config.Credentials)}); err != nil {
+		return err
+	}
+	msg, err := conn.Read()
+	if err != nil {
+		return err
+	}
+	if msg.Type != protocol.MessageTypeRequestBack || msg.ID != id {
+		return errors.New("unexpected handshake response")
+	}
+	if !msg.Success {
+		return transport.MessageError(msg)
+	}
 	return nil
 }
 
 func (c *Client) Push(route string, data any) error {
-	return c.push(route, data, false)
+	return c.push(route, data, c.isServerMode())
 }
 
 func (c *Client) push(route string, data any, isSystem bool) error {
@@ -125,11 +208,11 @@ func (c *Client) push(route string, data any, isSystem bool) error {
 	if err != nil {
 		return err
 	}
-	return c.send(&protocol.Message{ID: uuid.New().String(), Route: route, Type: protocol.MessageTypePush, Data: string(bytes)}, isSystem)
+	return c.send(&protocol.Message{ID: c.channel(isSystem).pending.NextID(), Route: route, Type: protocol.MessageTypePush, Data: bytes}, isSystem)
 }
 
 func (c *Client) RequestAsync(route string, data any, callback any) error {
-	return c.requestAsync(route, data, callback, false)
+	return c.requestAsync(route, data, callback, c.isServerMode())
 }
 
 func (c *Client) requestAsync(route string, data any, callback any, isSystem bool) error {
@@ -142,7 +225,7 @@ func (c *Client) requestAsync(route string, data any, callback any, isSystem boo
 }
 
 func (c *Client) Request(ctx context.Context, route string, data any, callback any) error {
-	return c.request(ctx, route, data, callback, false)
+	return c.request(ctx, route, data, callback, c.isServerMode())
 }
 
 func (c *Client) request(ctx context.Context, route string, data any, callback any, isSystem bool) error {
@@ -158,12 +241,27 @@ func (c *Client) request(ctx context.Context, route string, data any, callback a
 	return store.Wait(ctx, req)
 }
 
-func (c *Client) sendRequest(id, route string, data any, isSystem bool) error {
+// RequestRaw 发送请求并返回未解码的响应载荷
+func (c *Client) RequestRaw(ctx context.Context, route string, data any) ([]byte, error) {
+	return c.requestRaw(ctx, route, data, c.isServerMode())
+}
+
+func (c *Client) requestRaw(ctx context.Context, route string, data any, isSystem bool) ([]byte, error) {
+	store := c.channel(isSystem).pending
+	req := store.Add(nil)
+	if err := c.sendRequest(req.ID, route, data, isSystem); err != nil {
+		store.Delete(req.ID)
+		return nil, err
+	}
+	return store.WaitResult(ctx, req)
+}
+
+func (c *Client) sendRequest(id uint64, route string, data any, isSystem bool) error {
 	bytes, err := c.config.Codec.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return c.send(&protocol.Message{ID: id, Route: route, Type: protocol.MessageTypeRequest, Data: string(bytes)}, isSystem)
+	return c.send(&protocol.Message{ID: id, Route: route, Type: protocol.MessageTypeRequest, Data: bytes}, isSystem)
 }
 
 func (c *Client) send(msg *protocol.Message, isSystem bool) error {
@@ -181,6 +279,18 @@ func (c *Client) send(msg *protocol.Message, isSystem bool) error {
 	return conn.Send(msg)
 }
 
+// RTT 返回业务链路最近一次测得的往返时延
+func (c *Client) RTT() time.Duration {
+	ch := c.primary()
+	ch.lock.RLock()
+	conn := ch.conn
+	ch.lock.RUnlock()
+	if conn == nil {
+		return 0
+	}
+	return conn.RTT()
+}
+
 func (c *Client) Close() error {
 	errUser := c.closeChannel(c.user)
 	errSystem := c.closeChannel(c.system)
@@ -197,6 +307,7 @@ func (c *Client) closeChannel(ch *channel) error {
 		return nil
 	}
 	ch.closed = true
+	close(ch.done)
 	if ch.cancel != nil {
 		ch.cancel()
 	}
@@ -210,6 +321,16 @@ func (c *Client) closeChannel(ch *channel) error {
 	return nil
 }
 
+// isServerMode 服务器模式下只建立系统链路 公开的收发方法均走系统链路
+func (c *Client) isServerMode() bool {
+	return c.config.Mode == core.ModeServer
+}
+
+// primary 返回承载业务收发的链路 生命周期回调只针对该链路
+func (c *Client) primary() *channel {
+	return c.channel(c.isServerMode())
+}
+
 func (c *Client) channel(isSystem bool) *channel {
 	if isSystem {
 		return c.system
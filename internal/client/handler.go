@@ -5,13 +5,17 @@ import (
 	"fmt"
 
 	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/dispatch"
 	"github.com/zmhuanf/feng/internal/pending"
 	"github.com/zmhuanf/feng/internal/protocol"
 	"github.com/zmhuanf/feng/internal/router"
+	"github.com/zmhuanf/feng/internal/transport"
 )
 
-func (c *Client) readLoop(ctx context.Context, ch *channel) {
+func (c *Client) readLoop(ctx context.Context, ch *channel, conn *transport.Conn) {
 	clientCtx := core.NewClientContext(c)
+	// 应答类消息在读循环内处理 保证处理函数等待对端应答时不会死锁
+	dispatcher := dispatch.New(c.config.DispatchMode, c.config.MaxInFlight)
 	for {
 		select {
 		case <-ctx.Done():
@@ -19,25 +23,84 @@ func (c *Client) readLoop(ctx context.Context, ch *channel) {
 		default:
 		}
 
-		msg, err := ch.conn.Read()
+		msg, err := conn.Read()
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			c.config.Logger.Error("read message failed", "err", err)
+			c.handleDisconnect(ch, conn, err)
 			return
 		}
-		if err := c.dispatch(clientCtx, ch, msg); err != nil {
-			c.config.Logger.Error("dispatch message failed", "err", err)
+		if msg.Type == protocol.MessageTypePush && msg.Route == protocol.RouteKick {
+			c.handleDisconnect(ch, conn, transport.MessageError(msg))
+			return
+		}
+		if msg.Type != protocol.MessageTypeRequest && msg.Type != protocol.MessageTypePush {
+			if !c.safeDispatch(clientCtx, ch, conn, msg) {
+				c.handleDisconnect(ch, conn, core.ErrInternal)
+				return
+			}
+			continue
+		}
+		submitted := dispatcher.Submit(ch.router.Resolve(msg.Route, msg.RouteID), func() {
+			if !c.safeDispatch(clientCtx, ch, conn, msg) {
+				c.handleDisconnect(ch, conn, core.ErrInternal)
+			}
+		})
+		if !submitted {
+			if err := c.failMessage(ch, conn, msg, core.ErrBusy); err != nil {
+				c.config.Logger.Error("send busy response failed", "err", err)
+			}
+		}
+	}
+}
+
+// safeDispatch 处理单条消息 处理函数 panic 时恢复并按策略决定是否保留连接
+func (c *Client) safeDispatch(ctx core.ClientContext, ch *channel, conn *transport.Conn, msg *protocol.Message) (keep bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			core.ReportPanic(c.config.Logger, c.config.OnPanic, core.NewPanicInfo(msg.Route, "", msg.ID, r))
+			if err := c.failMessage(ch, conn, msg, core.ErrInternal); err != nil {
+				c.config.Logger.Error("send panic response failed", "err", err)
+			}
+			keep = c.config.PanicPolicy != core.PanicCloseConnection
 		}
+	}()
+	if err := c.dispatch(ctx, ch, conn, msg); err != nil {
+		c.config.Logger.Error("dispatch message failed", "err", err)
+	}
+	return true
+}
+
+// failMessage 向对端返回失败响应 或让等待中的请求失败
+func (c *Client) failMessage(ch *channel, conn *transport.Conn, msg *protocol.Message, cause error) error {
+	switch msg.Type {
+	case protocol.MessageTypeRequest:
+		return conn.Send(transport.FailMessage(msg.ID, protocol.MessageTypeRequestBack, cause))
+	case protocol.MessageTypePush:
+		return conn.Send(transport.FailMessage(msg.ID, protocol.MessageTypePushBack, cause))
+	case protocol.MessageTypeRequestBack:
+		ch.pending.Resolve(msg.ID, pending.Result{Success: false, Data: core.AsError(cause)})
 	}
+	return nil
 }
 
-func (c *Client) dispatch(ctx core.ClientContext, ch *channel, msg *protocol.Message) error {
+func (c *Client) dispatch(ctx core.ClientContext, ch *channel, conn *transport.Conn, msg *protocol.Message) error {
 	switch msg.Type {
 	case protocol.MessageTypePushBack:
 		return nil
 	case protocol.MessageTypeRequestBack:
 		return c.handleRequestBack(ctx, ch.pending, msg)
 	case protocol.MessageTypePush, protocol.MessageTypeRequest:
-		return c.handleIncoming(ctx, ch, msg)
+		return c.handleIncoming(ctx, ch, conn, msg)
+	case protocol.MessageTypeRouteTable:
+		table, err := protocol.DecodeRouteTable(msg.Data)
+		if err != nil {
+			return err
+		}
+		conn.SetRemoteRoutes(table)
+		return nil
 	default:
 		return fmt.Errorf("unknown message type: %d", msg.Type)
 	}
@@ -49,34 +112,48 @@ func (c *Client) handleRequestBack(ctx core.ClientContext, store *pending.Store,
 		return nil
 	}
 	if !msg.Success {
-		store.Resolve(msg.ID, pending.Result{Success: false, Data: msg.Data})
+		store.Resolve(msg.ID, pending.Result{Success: false, Data: transport.MessageError(msg)})
+		return nil
+	}
+	if req.Callback == nil {
+		store.Resolve(msg.ID, pending.Result{Success: true, Data: msg.Data})
 		return nil
 	}
 	if _, err := router.Call(req.Callback, ctx, msg.Data, c.config.Codec); err != nil {
-		store.Resolve(msg.ID, pending.Result{Success: false, Data: err.Error()})
+		store.Resolve(msg.ID, pending.Result{Success: false, Data: core.AsError(err)})
 		return nil
 	}
 	store.Resolve(msg.ID, pending.Result{Success: true})
 	return nil
 }
 
-func (c *Client) handleIncoming(ctx core.ClientContext, ch *channel, msg *protocol.Message) error {
+func (c *Client) handleIncoming(ctx core.ClientContext, ch *channel, conn *transport.Conn, msg *protocol.Message) error {
 	responseType := protocol.MessageTypeRequestBack
 	if msg.Type == protocol.MessageTypePush {
 		responseType = protocol.MessageTypePushBack
 	}
-	for _, middleware := range ch.router.Middlewares(msg.Route) {
-		if _, err := router.Call(middleware.Fn, ctx, msg.Data, c.config.Codec); err != nil {
-			return ch.conn.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: err.Error(), Success: false})
+	if msg.RouteID != 0 {
+		route, ok := ch.router.Route(msg.RouteID)
+		if !ok {
+			return conn.Send(transport.FailMessage(msg.ID, responseType, core.ErrNotFound))
 		}
+		msg.Route = route
 	}
-	fn, ok := ch.router.Handler(msg.Route)
-	if !ok {
-		return ch.conn.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: "route not found", Success: false})
-	}
-	result, err := router.Call(fn, ctx, msg.Data, c.config.Codec)
+	fn, params, ok := ch.router.Match(msg.Route)
+	msgCtx := core.NewClientMessageContext(ctx, msg.Route, params, msg.Data)
+	err := router.Run(ch.router.Middlewares(msg.Route), msgCtx, c.config.Codec, func() error {
+		if !ok {
+			return core.ErrNotFound
+		}
+		result, err := router.Call(fn, msgCtx, msgCtx.Payload(), c.config.Codec)
+		if err != nil {
+			return err
+		}
+		msgCtx.SetResponse(result)
+		return nil
+	})
 	if err != nil {
-		return ch.conn.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: err.Error(), Success: false})
+		return conn.Send(transport.FailMessage(msg.ID, responseType, err))
 	}
-	return ch.conn.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: result, Success: true})
+	return conn.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: msgCtx.Response(), Success: true})
 }
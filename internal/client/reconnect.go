@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/transport"
+)
+
+// handleDisconnect 处理读循环意外退出 结束等待中的请求并按配置发起重连
+func (c *Client) handleDisconnect(ch *channel, conn *transport.Conn, cause error) {
+	ch.lock.Lock()
+	if ch.closed || ch.conn != conn {
+		ch.lock.Unlock()
+		return
+	}
+	ch.conn = nil
+	ch.lock.Unlock()
+	_ = conn.Close()
+	ch.pending.Fail(core.ErrConnectionLost)
+
+	if ch != c.primary() {
+		return
+	}
+	if c.config.OnDisconnect != nil {
+		c.config.OnDisconnect(cause)
+	}
+	// 被踢下线时不重连 否则两个连接会互相踢下对方
+	if c.config.EnableReconnect && !c.isServerMode() && !kicked(cause) {
+		go c.reconnect(ch, cause)
+	}
+}
+
+// kicked 判断断开原因是否为服务器按重复登录策略踢下连接
+func kicked(cause error) bool {
+	return errors.Is(cause, core.ErrKicked) || errors.Is(cause, core.ErrDuplicateLogin)
+}
+
+// reconnect 按指数退避重连原节点 并携带令牌请求恢复会话
+func (c *Client) reconnect(ch *channel, cause error) {
+	ch.lock.RLock()
+	url := ch.url
+	ch.lock.RUnlock()
+
+	delay := c.config.ReconnectBaseDelay
+	for attempt := 1; c.config.ReconnectMaxAttempts == 0 || attempt <= c.config.ReconnectMaxAttempts; attempt++ {
+		// 在 [delay/2, delay] 内随机等待 避免大量客户端同时重连
+		wait := delay/2 + rand.N(delay/2+1)
+		select {
+		case <-ch.done:
+			return
+		case <-time.After(wait):
+		}
+		resumed, err := c.dialChannel(context.Background(), ch, url)
+		if err == nil {
+			c.config.Logger.Info("reconnected", "attempt", attempt, "resumed", resumed)
+			if c.config.OnReconnect != nil {
+				c.config.OnReconnect(resumed)
+			}
+			return
+		}
+		cause = err
+		c.config.Logger.Warn("reconnect failed", "attempt", attempt, "err", err)
+		delay = min(delay*2, c.config.ReconnectMaxDelay)
+	}
+	if c.config.OnGiveUp != nil {
+		c.config.OnGiveUp(cause)
+	}
+}
@@ -0,0 +1,13 @@
+package core
+
+// ConnectionStats 是连接准入的统计数据
+type ConnectionStats struct {
+	// 当前计入限制的连接数
+	Active int
+	// 因 Origin 不在允许列表而拒绝的次数
+	RejectedOrigin uint64
+	// 因超过 MaxConnections 而拒绝的次数
+	RejectedTotal uint64
+	// 因超过 MaxConnectionsPerIP 而拒绝的次数
+	RejectedPerIP uint64
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// AuthRequest 是认证器可见的连接信息
+type AuthRequest struct {
+	// 升级请求的请求头和查询参数 浏览器无法自定义请求头时可将令牌放在查询参数中
+	Header     http.Header
+	Query      url.Values
+	RemoteAddr string
+	// 首条消息握手认证时客户端发送的凭据
+	Credentials []byte
+}
+
+// Authenticator 认证 /game 连接并返回稳定的用户 ID 返回错误时拒绝连接
+type Authenticator interface {
+	Authenticate(ctx context.Context, req AuthRequest) (string, error)
+}
+
+// AuthenticatorFunc 将普通函数适配为 Authenticator
+type AuthenticatorFunc func(ctx context.Context, req AuthRequest) (string, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, req AuthRequest) (string, error) {
+	return f(ctx, req)
+}
+
+// AuthError 将认证失败转换为返回给客户端的错误 普通 error 使用 CodeUnauthorized
+func AuthError(err error) *Error {
+	if e := AsError(err); e.Code != CodeApplication {
+		return e
+	}
+	return NewError(CodeUnauthorized, err.Error())
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// Status 描述集群中一个节点的负载状态。
+type Status struct {
+	URL        string    `json:"url"`
+	Load       int       `json:"load"`
+	ID         string    `json:"id"`
+	ReportTime time.Time `json:"reportTime"`
+}
+
+// Balancer 从存活节点中选出一个承接新连接的节点。
+type Balancer interface {
+	Pick(candidates []Status) (Status, bool)
+}
+
+type leastLoadBalancer struct{}
+
+func NewLeastLoadBalancer() Balancer {
+	return leastLoadBalancer{}
+}
+
+func (leastLoadBalancer) Pick(candidates []Status) (Status, bool) {
+	if len(candidates) == 0 {
+		return Status{}, false
+	}
+	best := candidates[0]
+	for _, status := range candidates[1:] {
+		if status.Load < best.Load {
+			best = status
+		}
+	}
+	return best, true
+}
+
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{}
+}
+
+func (b *roundRobinBalancer) Pick(candidates []Status) (Status, bool) {
+	if len(candidates) == 0 {
+		return Status{}, false
+	}
+	n := b.next.Add(1) - 1
+	return candidates[n%uint64(len(candidates))], true
+}
+
+type weightedRandomBalancer struct{}
+
+// NewWeightedRandomBalancer 按 1/(Load+1) 的权重随机选择节点。
+func NewWeightedRandomBalancer() Balancer {
+	return weightedRandomBalancer{}
+}
+
+func (weightedRandomBalancer) Pick(candidates []Status) (Status, bool) {
+	if len(candidates) == 0 {
+		return Status{}, false
+	}
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, status := range candidates {
+		weights[i] = 1 / float64(max(status.Load, 0)+1)
+		total += weights[i]
+	}
+	r := rand.Float64() * total
+	for i, weight := range weights {
+		if r < weight {
+			return candidates[i], true
+		}
+		r -= weight
+	}
+	return candidates[len(candidates)-1], true
+}
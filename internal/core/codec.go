@@ -5,17 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 
-	"github.com/gorilla/websocket"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // ErrInvalidProtoMessage 表示传入对象未实现 proto.Message 接口。
 var ErrInvalidProtoMessage = errors.New("codec: value does not implement proto.Message")
 
+// Codec 只编码消息载荷 帧格式由传输层决定
 type Codec interface {
 	Marshal(v any) ([]byte, error)
 	Unmarshal(data []byte, v any) error
-	MessageType() int
 }
 
 type jsonCodec struct{}
@@ -44,19 +44,25 @@ func (jsonCodec) Unmarshal(data []byte, v any) error {
 	return json.Unmarshal(data, v)
 }
 
-func (jsonCodec) MessageType() int { return websocket.TextMessage }
-
 type protoCodec struct{}
 
 func NewProtoCodec() Codec {
 	return protoCodec{}
 }
 
+// Marshal 编码 proto.Message 原始字节与字符串原样透传 布尔和数值类型使用 wrapperspb 包装
 func (protoCodec) Marshal(v any) ([]byte, error) {
-	if v == nil {
+	switch val := v.(type) {
+	case nil:
 		return []byte(""), nil
+	case []byte:
+		return val, nil
+	case string:
+		return []byte(val), nil
+	case proto.Message:
+		return proto.Marshal(val)
 	}
-	msg, ok := v.(proto.Message)
+	msg, ok := wrapScalar(v)
 	if !ok {
 		return nil, ErrInvalidProtoMessage
 	}
@@ -64,11 +70,102 @@ func (protoCodec) Marshal(v any) ([]byte, error) {
 }
 
 func (protoCodec) Unmarshal(data []byte, v any) error {
-	msg, ok := v.(proto.Message)
-	if !ok {
+	switch val := v.(type) {
+	case *[]byte:
+		*val = data
+		return nil
+	case *string:
+		*val = string(data)
+		return nil
+	case proto.Message:
+		return proto.Unmarshal(data, val)
+	}
+	return unwrapScalar(data, v)
+}
+
+func wrapScalar(v any) (proto.Message, bool) {
+	switch val := v.(type) {
+	case bool:
+		return wrapperspb.Bool(val), true
+	case int:
+		return wrapperspb.Int64(int64(val)), true
+	case int8:
+		return wrapperspb.Int32(int32(val)), true
+	case int16:
+		return wrapperspb.Int32(int32(val)), true
+	case int32:
+		return wrapperspb.Int32(val), true
+	case int64:
+		return wrapperspb.Int64(val), true
+	case uint:
+		return wrapperspb.UInt64(uint64(val)), true
+	case uint8:
+		return wrapperspb.UInt32(uint32(val)), true
+	case uint16:
+		return wrapperspb.UInt32(uint32(val)), true
+	case uint32:
+		return wrapperspb.UInt32(val), true
+	case uint64:
+		return wrapperspb.UInt64(val), true
+	case float32:
+		return wrapperspb.Float(val), true
+	case float64:
+		return wrapperspb.Double(val), true
+	}
+	return nil, false
+}
+
+func unwrapScalar(data []byte, v any) error {
+	var err error
+	switch val := v.(type) {
+	case *bool:
+		*val, err = unwrap(data, &wrapperspb.BoolValue{})
+	case *int:
+		var n int64
+		n, err = unwrap(data, &wrapperspb.Int64Value{})
+		*val = int(n)
+	case *int8:
+		var n int32
+		n, err = unwrap(data, &wrapperspb.Int32Value{})
+		*val = int8(n)
+	case *int16:
+		var n int32
+		n, err = unwrap(data, &wrapperspb.Int32Value{})
+		*val = int16(n)
+	case *int32:
+		*val, err = unwrap(data, &wrapperspb.Int32Value{})
+	case *int64:
+		*val, err = unwrap(data, &wrapperspb.Int64Value{})
+	case *uint:
+		var n uint64
+		n, err = unwrap(data, &wrapperspb.UInt64Value{})
+		*val = uint(n)
+	case *uint8:
+		var n uint32
+		n, err = unwrap(data, &wrapperspb.UInt32Value{})
+		*val = uint8(n)
+	case *uint16:
+		var n uint32
+		n, err = unwrap(data, &wrapperspb.UInt32Value{})
+		*val = uint16(n)
+	case *uint32:
+		*val, err = unwrap(data, &wrapperspb.UInt32Value{})
+	case *uint64:
+		*val, err = unwrap(data, &wrapperspb.UInt64Value{})
+	case *float32:
+		*val, err = unwrap(data, &wrapperspb.FloatValue{})
+	case *float64:
+		*val, err = unwrap(data, &wrapperspb.DoubleValue{})
+	default:
 		return ErrInvalidProtoMessage
 	}
-	return proto.Unmarshal(data, msg)
+	return err
 }
 
-func (protoCodec) MessageType() int { return websocket.BinaryMessage }
+func unwrap[T any, W interface {
+	proto.Message
+	GetValue() T
+}](data []byte, msg W) (T, error) {
+	err := proto.Unmarshal(data, msg)
+	return msg.GetValue(), err
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxDecompressedSize 是未设置上限时单条消息解压后的最大字节数
+const maxDecompressedSize = 64 << 20
+
+// ErrDecompressedTooLarge 表示载荷解压后超过上限 防止压缩炸弹
+var ErrDecompressedTooLarge = errors.New("decompressed payload too large")
+
+// Compressor 在应用层压缩消息载荷 双方配置的 Name 一致时才会启用。
+type Compressor interface {
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	// Decompress 解压载荷 结果超过 maxSize 字节时返回 ErrDecompressedTooLarge maxSize 不大于 0 时使用默认上限 64 MiB
+	Decompress(src []byte, maxSize int) ([]byte, error)
+}
+
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func NewZstdCompressor() Compressor {
+	// 参数均为合法常量 不会返回错误
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	decoder, _ := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+	return &zstdCompressor{encoder: encoder, decoder: decoder}
+}
+
+func (*zstdCompressor) Name() string { return "zstd" }
+
+func (c *zstdCompressor) Compress(src []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(src, nil), nil
+}
+
+func (c *zstdCompressor) Decompress(src []byte, maxSize int) ([]byte, error) {
+	maxSize = decompressLimit(maxSize)
+	// 帧头声明了原始大小时 在分配内存前拒绝
+	var header zstd.Header
+	if err := header.Decode(src); err == nil && header.HasFCS && header.FrameContentSize > uint64(maxSize) {
+		return nil, ErrDecompressedTooLarge
+	}
+	data, err := c.decoder.DecodeAll(src, nil)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, ErrDecompressedTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, ErrDecompressedTooLarge
+	}
+	return data, nil
+}
+
+type snappyCompressor struct{}
+
+func NewSnappyCompressor() Compressor {
+	return snappyCompressor{}
+}
+
+func (snappyCompressor) Name() string { return "snappy" }
+
+func (snappyCompressor) Compress(src []byte) ([]byte, error) {
+	return s2.EncodeSnappy(nil, src), nil
+}
+
+func (snappyCompressor) Decompress(src []byte, maxSize int) ([]byte, error) {
+	size, err := s2.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if size > decompressLimit(maxSize) {
+		return nil, ErrDecompressedTooLarge
+	}
+	return s2.Decode(nil, src)
+}
+
+func decompressLimit(maxSize int) int {
+	if maxSize <= 0 || maxSize > maxDecompressedSize {
+		return maxDecompressedSize
+	}
+	return maxSize
+}
@@ -17,32 +17,144 @@ type ServerConfig struct {
 	KeyFile string
 	// 全局请求超时时间。
 	Timeout time.Duration
-	// 要加入的服务器网络地址。
+	// 要加入的服务器网络地址（host:port）。
 	JoinNetwork string
+	// 对外公布的地址（host:port），为空时使用 Addr:Port；Addr 未指定（如 0.0.0.0）时加入服务器网络必须设置。
+	AdvertiseAddr string
 	// 服务器网络签名密钥。
 	NetworkSignKey string
+	// 系统链路认证签名中时间戳允许的最大偏差。
+	NetworkSignWindow time.Duration
+	// 系统链路单独监听的内网地址（host:port），为空时与 /game 共用端口。
+	SystemAddr string
 	// 心跳上报间隔。
 	ReportInterval time.Duration
 	// 超时节点清理间隔。
 	RemoveInterval time.Duration
+	// 节点状态过期时间，超过该时间未上报的节点不参与选择。
+	PeerTimeout time.Duration
+	// 节点选择策略。
+	Balancer Balancer
 	// 每页房间/用户数量。
 	PageSize int
+	// 断线后保留会话等待客户端恢复的时间，0 表示不保留。
+	ResumeTimeout time.Duration
+	// 心跳 ping 发送间隔，小于 0 表示不启用心跳。
+	PingInterval time.Duration
+	// 等待 pong 的超时时间，超时未收到任何数据的连接将被关闭。
+	PongTimeout time.Duration
+	// 是否协商 WebSocket permessage-deflate 压缩。
+	EnableCompression bool
+	// 应用层载荷压缩算法，为 nil 时不启用。
+	Compressor Compressor
+	// 启用压缩的最小消息字节数。
+	CompressThreshold int
+	// 处理函数 panic 后对连接的处理方式。
+	PanicPolicy PanicPolicy
+	// 处理函数 panic 时回调，可用于自定义上报。
+	OnPanic func(info PanicInfo)
+	// 单个连接内消息的处理方式。
+	DispatchMode DispatchMode
+	// 单个连接排队与处理中的消息上限，超出的消息直接返回失败。
+	MaxInFlight int
+	// 处理函数参数校验器，为 nil 时不校验。
+	Validator Validator
+	// 玩家认证器，为 nil 时不认证并为每个连接生成随机用户 ID。
+	Authenticator Authenticator
+	// 是否通过连接后的首条消息认证，否则在升级时根据请求头和查询参数认证。
+	AuthHandshake bool
+	// 等待首条认证消息的时间。
+	AuthTimeout time.Duration
+	// 同一用户 ID 重复登录时的处理方式。
+	DuplicateLogin DuplicateLoginPolicy
+	// 允许的浏览器来源，如 https://game.example.com 或 https://*.example.com，为空时允许所有来源。
+	AllowedOrigins []string
+	// 最大连接数，0 表示不限制。
+	MaxConnections int
+	// 单个 IP 的最大连接数，0 表示不限制。
+	MaxConnectionsPerIP int
+	// 信任的反向代理地址或网段，只有来自这些地址的请求才按 X-Forwarded-For 等请求头取客户端 IP，为空时只使用连接的远端地址。
+	TrustedProxies []string
+	// 单条消息的最大字节数（压缩载荷按解压后计算），超出时关闭连接，0 表示不限制。
+	MaxMessageSize int64
+	// 每个用户全部消息的限流，Rate 为 0 表示不限制。
+	RateLimit RateLimit
+	// 按路由模式单独限流，如 "/move" 或 "/room/:id/chat"。
+	RouteRateLimits map[string]RateLimit
+	// 超出限流时的处理方式。
+	RateLimitAction RateLimitAction
+	// 单个用户累计超出限流的次数达到该值时断开连接，0 表示不断开。
+	RateLimitDisconnect int
+	// 每个连接发送队列的容量，小于 0 表示不使用队列而在调用方同步写入。
+	SendQueueSize int
+	// 发送队列满时的处理方式。
+	SendQueuePolicy SendQueuePolicy
+	// 单条消息的写超时，超时的连接将被关闭，小于 0 表示不限制。
+	WriteTimeout time.Duration
 }
 
 func NewDefaultServerConfig() ServerConfig {
 	return ServerConfig{
-		Addr:           "0.0.0.0",
-		Port:           22100,
-		Codec:          NewJSONCodec(),
-		Logger:         NewSlogLogger(),
-		Timeout:        5 * time.Minute,
-		NetworkSignKey: GenerateRandomKey(64),
-		ReportInterval: time.Minute,
-		RemoveInterval: 10 * time.Second,
-		PageSize:       10,
+		Addr:              "0.0.0.0",
+		Port:              22100,
+		Codec:             NewJSONCodec(),
+		Logger:            NewSlogLogger(),
+		Timeout:           5 * time.Minute,
+		NetworkSignKey:    GenerateRandomKey(64),
+		NetworkSignWindow: 30 * time.Second,
+		ReportInterval:    time.Minute,
+		RemoveInterval:    10 * time.Second,
+		PeerTimeout:       3 * time.Minute,
+		Balancer:          NewLeastLoadBalancer(),
+		PageSize:          10,
+		PingInterval:      15 * time.Second,
+		PongTimeout:       10 * time.Second,
+		CompressThreshold: 1024,
+		MaxInFlight:       256,
+		AuthTimeout:       10 * time.Second,
+		SendQueueSize:     256,
+		SendQueuePolicy:   SendQueueDropOldest,
+		WriteTimeout:      10 * time.Second,
 	}
 }
 
+// DispatchMode 单个连接内消息的处理方式
+type DispatchMode int
+
+const (
+	// DispatchOrdered 按到达顺序逐条处理
+	DispatchOrdered DispatchMode = iota
+	// DispatchOrderedPerRoute 同一路由按顺序处理 不同路由并发处理
+	DispatchOrderedPerRoute
+	// DispatchConcurrent 全部并发处理
+	DispatchConcurrent
+)
+
+// SendQueuePolicy 发送队列满时的处理方式
+// 只有 PushDroppable 发出的推送可以被丢弃或合并 其余消息总是保留
+type SendQueuePolicy int
+
+const (
+	// SendQueueDropOldest 丢弃最早的可丢弃推送 没有可丢弃的推送时断开连接
+	SendQueueDropOldest SendQueuePolicy = iota
+	// SendQueueCoalesce 用新推送替换队列中 key 相同的推送 没有相同 key 时按 SendQueueDropOldest 处理
+	SendQueueCoalesce
+	// SendQueueDisconnect 直接断开消费过慢的连接
+	SendQueueDisconnect
+)
+
+// DuplicateLoginPolicy 同一用户 ID 重复登录时的处理方式
+type DuplicateLoginPolicy int
+
+const (
+	// DuplicateReject 拒绝新连接 断线等待恢复的会话同样视为在线
+	DuplicateReject DuplicateLoginPolicy = iota
+	// DuplicateKick 踢下旧连接并移除其用户 新连接使用全新的用户
+	DuplicateKick
+	// DuplicateTakeOver 踢下旧连接 新连接接管原用户的房间和附加数据
+	DuplicateTakeOver
+)
+
 type Mode int
 
 const (
@@ -67,17 +179,59 @@ type ClientConfig struct {
 	DirectConnect bool
 	// 内部连接模式。
 	Mode Mode
+	// 心跳 ping 发送间隔，小于 0 表示不启用心跳。
+	PingInterval time.Duration
+	// 等待 pong 的超时时间，超时未收到任何数据的连接将被关闭。
+	PongTimeout time.Duration
+	// 是否协商 WebSocket permessage-deflate 压缩。
+	EnableCompression bool
+	// 应用层载荷压缩算法，为 nil 时不启用。
+	Compressor Compressor
+	// 启用压缩的最小消息字节数。
+	CompressThreshold int
+	// 处理函数 panic 后对连接的处理方式。
+	PanicPolicy PanicPolicy
+	// 处理函数 panic 时回调，可用于自定义上报。
+	OnPanic func(info PanicInfo)
+	// 单个连接内消息的处理方式。
+	DispatchMode DispatchMode
+	// 单个连接排队与处理中的消息上限，超出的消息直接返回失败。
+	MaxInFlight int
+	// 认证凭据，升级时作为 Authorization 头发送，首条消息认证时作为消息内容发送。
+	Credentials string
+	// 是否通过连接后的首条消息认证，需与服务器配置一致。
+	AuthHandshake bool
+	// 是否在断线后自动重连。
+	EnableReconnect bool
+	// 首次重连等待时间，之后按指数退避增长。
+	ReconnectBaseDelay time.Duration
+	// 重连等待时间上限。
+	ReconnectMaxDelay time.Duration
+	// 最大重连次数，0 表示不限次数。
+	ReconnectMaxAttempts int
+	// 连接断开时回调。
+	OnDisconnect func(err error)
+	// 重连成功时回调，resumed 表示是否恢复了原会话。
+	OnReconnect func(resumed bool)
+	// 放弃重连时回调。
+	OnGiveUp func(err error)
 }
 
 func NewDefaultClientConfig() ClientConfig {
 	return ClientConfig{
-		Addr:          "127.0.0.1",
-		Port:          22100,
-		Codec:         NewJSONCodec(),
-		Logger:        NewSlogLogger(),
-		Timeout:       5 * time.Minute,
-		DirectConnect: true,
-		Mode:          ModeClient,
+		Addr:               "127.0.0.1",
+		Port:               22100,
+		Codec:              NewJSONCodec(),
+		Logger:             NewSlogLogger(),
+		Timeout:            5 * time.Minute,
+		DirectConnect:      true,
+		Mode:               ModeClient,
+		PingInterval:       15 * time.Second,
+		PongTimeout:        10 * time.Second,
+		CompressThreshold:  1024,
+		MaxInFlight:        256,
+		ReconnectBaseDelay: 500 * time.Millisecond,
+		ReconnectMaxDelay:  30 * time.Second,
 	}
 }
 
@@ -101,15 +255,45 @@ func NormalizeServerConfig(config ServerConfig) ServerConfig {
 	if config.NetworkSignKey == "" {
 		config.NetworkSignKey = defaults.NetworkSignKey
 	}
+	if config.NetworkSignWindow <= 0 {
+		config.NetworkSignWindow = defaults.NetworkSignWindow
+	}
 	if config.ReportInterval == 0 {
 		config.ReportInterval = defaults.ReportInterval
 	}
 	if config.RemoveInterval == 0 {
 		config.RemoveInterval = defaults.RemoveInterval
 	}
+	if config.PeerTimeout == 0 {
+		config.PeerTimeout = defaults.PeerTimeout
+	}
+	if config.Balancer == nil {
+		config.Balancer = defaults.Balancer
+	}
 	if config.PageSize <= 0 {
 		config.PageSize = defaults.PageSize
 	}
+	if config.PingInterval == 0 {
+		config.PingInterval = defaults.PingInterval
+	}
+	if config.PongTimeout == 0 {
+		config.PongTimeout = defaults.PongTimeout
+	}
+	if config.CompressThreshold <= 0 {
+		config.CompressThreshold = defaults.CompressThreshold
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = defaults.MaxInFlight
+	}
+	if config.AuthTimeout <= 0 {
+		config.AuthTimeout = defaults.AuthTimeout
+	}
+	if config.SendQueueSize == 0 {
+		config.SendQueueSize = defaults.SendQueueSize
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = defaults.WriteTimeout
+	}
 	return config
 }
 
@@ -130,5 +314,23 @@ func NormalizeClientConfig(config ClientConfig) ClientConfig {
 	if config.Timeout == 0 {
 		config.Timeout = defaults.Timeout
 	}
+	if config.ReconnectBaseDelay == 0 {
+		config.ReconnectBaseDelay = defaults.ReconnectBaseDelay
+	}
+	if config.ReconnectMaxDelay == 0 {
+		config.ReconnectMaxDelay = defaults.ReconnectMaxDelay
+	}
+	if config.PingInterval == 0 {
+		config.PingInterval = defaults.PingInterval
+	}
+	if config.PongTimeout == 0 {
+		config.PongTimeout = defaults.PongTimeout
+	}
+	if config.CompressThreshold <= 0 {
+		config.CompressThreshold = defaults.CompressThreshold
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = defaults.MaxInFlight
+	}
 	return config
 }
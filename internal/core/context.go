@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,10 +17,14 @@ type Server interface {
 	Room(id string) (Room, error)
 	Rooms() []Room
 	RoomsByPage(page int) []Room
+	CreateRoom(options RoomOptions) (Room, error)
 	User(id string) (User, error)
 	Users() []User
 	UsersByPage(page int) []User
 	Gin() *gin.Engine
+	Multicast(route string, data any, userIDs []string) error
+	ConnectionStats() ConnectionStats
+	RateLimitStats() RateLimitStats
 }
 
 type Client interface {
@@ -30,6 +35,8 @@ type Client interface {
 	Push(route string, data any) error
 	RequestAsync(route string, data any, callback any) error
 	Request(context.Context, string, any, any) error
+	RequestRaw(ctx context.Context, route string, data any) ([]byte, error)
+	RTT() time.Duration
 	Close() error
 }
 
@@ -40,12 +47,24 @@ type Room interface {
 	Users() []User
 	UserCount() int
 	Page() int
+	Capacity() int
+	Private() bool
+	Creator() User
+	Host() User
+	SetHost(User) error
+	Metadata(key string) (any, bool)
+	SetMetadata(key string, value any)
+	Close() error
+	Closed() bool
+	Broadcast(route string, data any) error
+	BroadcastExcept(route string, data any, userIDs ...string) error
 }
 
 type User interface {
 	ID() string
 	Room() Room
 	JoinRoom(Room) error
+	JoinRoomWithPassword(room Room, password string) error
 	CreateAndJoinRoom() error
 	LeaveRoom() error
 	Context() ServerContext
@@ -53,8 +72,12 @@ type User interface {
 	SetExtraData(key string, value any)
 	Page() int
 	Push(route string, data any) error
+	PushDroppable(route string, data any, key string) error
 	Request(context.Context, string, any, any) error
 	RequestAsync(route string, data any, callback any) error
+	RequestRaw(ctx context.Context, route string, data any) ([]byte, error)
+	RTT() time.Duration
+	SendQueueDepth() int
 }
 
 type ServerContext interface {
@@ -64,10 +87,22 @@ type ServerContext interface {
 	Get(key string) (any, bool)
 	Set(key string, value any)
 	GinContext() *gin.Context
+	Route() string
+	Param(name string) string
+	Payload() []byte
+	SetPayload(data []byte)
+	Response() []byte
+	SetResponse(data []byte)
 }
 
 type ClientContext interface {
 	Client() Client
+	Route() string
+	Param(name string) string
+	Payload() []byte
+	SetPayload(data []byte)
+	Response() []byte
+	SetResponse(data []byte)
 }
 
 type BaseServerContext struct {
@@ -87,7 +122,18 @@ func (c *BaseServerContext) Bind(room Room, user User) {
 	c.user = user
 }
 
-func (c *BaseServerContext) Room() Room { return c.room }
+// BindGin 在会话恢复时切换到新连接的 gin 上下文
+func (c *BaseServerContext) BindGin(ginCtx *gin.Context) {
+	c.ginCtx = ginCtx
+}
+
+// Room 返回用户当前所在的房间 未加入房间时为 nil
+func (c *BaseServerContext) Room() Room {
+	if c.user != nil {
+		return c.user.Room()
+	}
+	return c.room
+}
 
 func (c *BaseServerContext) User() User { return c.user }
 
@@ -99,6 +145,18 @@ func (c *BaseServerContext) Set(key string, value any) { c.data.Store(key, value
 
 func (c *BaseServerContext) GinContext() *gin.Context { return c.ginCtx }
 
+func (c *BaseServerContext) Route() string { return "" }
+
+func (c *BaseServerContext) Param(name string) string { return "" }
+
+func (c *BaseServerContext) Payload() []byte { return nil }
+
+func (c *BaseServerContext) SetPayload(data []byte) {}
+
+func (c *BaseServerContext) Response() []byte { return nil }
+
+func (c *BaseServerContext) SetResponse(data []byte) {}
+
 type BaseClientContext struct {
 	client Client
 }
@@ -108,3 +166,80 @@ func NewClientContext(client Client) ClientContext {
 }
 
 func (c *BaseClientContext) Client() Client { return c.client }
+
+func (c *BaseClientContext) Route() string { return "" }
+
+func (c *BaseClientContext) Param(name string) string { return "" }
+
+func (c *BaseClientContext) Payload() []byte { return nil }
+
+func (c *BaseClientContext) SetPayload(data []byte) {}
+
+func (c *BaseClientContext) Response() []byte { return nil }
+
+func (c *BaseClientContext) SetResponse(data []byte) {}
+
+// serverMessageContext 为单条消息附加路由 参数 载荷与响应 其余方法沿用连接上下文
+type serverMessageContext struct {
+	ServerContext
+	message
+}
+
+// NewServerMessageContext 返回单条消息的服务端上下文
+func NewServerMessageContext(ctx ServerContext, route string, params map[string]string, payload []byte) ServerContext {
+	return &serverMessageContext{ServerContext: ctx, message: message{route: route, params: params, payload: payload}}
+}
+
+func (c *serverMessageContext) Route() string { return c.message.Route() }
+
+func (c *serverMessageContext) Param(name string) string { return c.message.Param(name) }
+
+func (c *serverMessageContext) Payload() []byte { return c.message.Payload() }
+
+func (c *serverMessageContext) SetPayload(data []byte) { c.message.SetPayload(data) }
+
+func (c *serverMessageContext) Response() []byte { return c.message.Response() }
+
+func (c *serverMessageContext) SetResponse(data []byte) { c.message.SetResponse(data) }
+
+type clientMessageContext struct {
+	ClientContext
+	message
+}
+
+// NewClientMessageContext 返回单条消息的客户端上下文
+func NewClientMessageContext(ctx ClientContext, route string, params map[string]string, payload []byte) ClientContext {
+	return &clientMessageContext{ClientContext: ctx, message: message{route: route, params: params, payload: payload}}
+}
+
+func (c *clientMessageContext) Route() string { return c.message.Route() }
+
+func (c *clientMessageContext) Param(name string) string { return c.message.Param(name) }
+
+func (c *clientMessageContext) Payload() []byte { return c.message.Payload() }
+
+func (c *clientMessageContext) SetPayload(data []byte) { c.message.SetPayload(data) }
+
+func (c *clientMessageContext) Response() []byte { return c.message.Response() }
+
+func (c *clientMessageContext) SetResponse(data []byte) { c.message.SetResponse(data) }
+
+// message 单条消息的处理状态 中间件可以在调用 next 前后读写载荷和响应
+type message struct {
+	route    string
+	params   map[string]string
+	payload  []byte
+	response []byte
+}
+
+func (m *message) Route() string { return m.route }
+
+func (m *message) Param(name string) string { return m.params[name] }
+
+func (m *message) Payload() []byte { return m.payload }
+
+func (m *message) SetPayload(data []byte) { m.payload = data }
+
+func (m *message) Response() []byte { return m.response }
+
+func (m *message) SetResponse(data []byte) { m.response = data }
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"strconv"
 )
 
 func Sign(message, secret string) string {
@@ -17,6 +18,15 @@ func Verify(message, secret, signature string) bool {
 	return hmac.Equal([]byte(Sign(message, secret)), []byte(signature))
 }
 
+// SignChallenge 对系统链路加入请求签名 签名覆盖节点地址 时间戳和服务器下发的挑战值
+func SignChallenge(url string, timestamp int64, nonce, secret string) string {
+	return Sign(url+"|"+strconv.FormatInt(timestamp, 10)+"|"+nonce, secret)
+}
+
+func VerifyChallenge(url string, timestamp int64, nonce, secret, signature string) bool {
+	return hmac.Equal([]byte(SignChallenge(url, timestamp, nonce, secret)), []byte(signature))
+}
+
 func GenerateRandomKey(length int) string {
 	key := make([]byte, length)
 	if _, err := rand.Read(key); err != nil {
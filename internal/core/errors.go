@@ -0,0 +1,118 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode 是失败回执中携带的错误码
+type ErrorCode uint32
+
+// 0 到 99 为框架保留的错误码 应用自定义错误码应不小于 CodeApplication
+const (
+	CodeUnknown ErrorCode = iota + 1
+	CodeInternal
+	CodeNotFound
+	CodeTimeout
+	CodeValidation
+	CodeUnauthorized
+	CodeBusy
+	CodeKicked
+	CodeDuplicateLogin
+	CodeRateLimited
+	CodeRoomFull
+	CodeRoomClosed
+	CodeRoomPassword
+	CodeConnectionLost
+
+	// CodeApplication 是处理函数返回普通 error 时使用的错误码
+	CodeApplication ErrorCode = 100
+)
+
+// Error 是可以跨连接传递的结构化错误
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Details map[string]string
+}
+
+func NewError(code ErrorCode, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Error 使用值接收者 处理函数可以直接返回 Error{...} 或 &Error{...}
+func (e Error) Error() string { return e.Message }
+
+// Is 按错误码比较 使 errors.Is(err, ErrNotFound) 对从对端收到的错误同样成立
+func (e Error) Is(target error) bool {
+	switch t := target.(type) {
+	case *Error:
+		return t.Code == e.Code
+	case Error:
+		return t.Code == e.Code
+	}
+	return false
+}
+
+// WithDetails 返回附带详情的副本
+func (e *Error) WithDetails(details map[string]string) *Error {
+	return &Error{Code: e.Code, Message: e.Message, Details: details}
+}
+
+// AsError 将任意错误转换为结构化错误 普通 error 使用 CodeApplication
+func AsError(err error) *Error {
+	var ptr *Error
+	if errors.As(err, &ptr) {
+		return ptr
+	}
+	var value Error
+	if errors.As(err, &value) {
+		return &value
+	}
+	return &Error{Code: CodeApplication, Message: err.Error()}
+}
+
+// MulticastError 汇总群发时发送失败的用户 键为用户 ID
+type MulticastError struct {
+	Errors map[string]error
+}
+
+func (e *MulticastError) Error() string {
+	return fmt.Sprintf("send failed for %d users", len(e.Errors))
+}
+
+// Unwrap 使 errors.Is 能匹配任一用户的错误
+func (e *MulticastError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+var (
+	// ErrConnectionLost 表示连接在请求完成前断开。
+	ErrConnectionLost = NewError(CodeConnectionLost, "connection lost")
+	// ErrInternal 是处理函数 panic 时返回给对端的错误 不暴露内部细节。
+	ErrInternal = NewError(CodeInternal, "internal error")
+	// ErrBusy 表示连接上待处理的消息超过上限。
+	ErrBusy = NewError(CodeBusy, "too many in-flight messages")
+	// ErrNotFound 表示没有与消息匹配的路由。
+	ErrNotFound = NewError(CodeNotFound, "route not found")
+	// ErrTimeout 表示请求在超时前没有收到应答。
+	ErrTimeout = NewError(CodeTimeout, "request timeout")
+	// ErrUnauthorized 表示连接未通过认证。
+	ErrUnauthorized = NewError(CodeUnauthorized, "unauthorized")
+	// ErrKicked 是同一用户在其他连接登录后 旧连接收到的断开原因。
+	ErrKicked = NewError(CodeKicked, "logged in from another connection")
+	// ErrDuplicateLogin 表示用户已在线 新连接被拒绝。
+	ErrDuplicateLogin = NewError(CodeDuplicateLogin, "user already logged in")
+	// ErrRateLimited 表示消息超出限流被丢弃。
+	ErrRateLimited = NewError(CodeRateLimited, "rate limit exceeded")
+	// ErrRoomFull 表示房间人数已达上限。
+	ErrRoomFull = NewError(CodeRoomFull, "room is full")
+	// ErrRoomClosed 表示房间已关闭。
+	ErrRoomClosed = NewError(CodeRoomClosed, "room is closed")
+	// ErrRoomPassword 表示加入房间的密码错误。
+	ErrRoomPassword = NewError(CodeRoomPassword, "wrong room password")
+)
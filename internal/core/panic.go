@@ -0,0 +1,37 @@
+package core
+
+import "runtime/debug"
+
+// PanicPolicy 处理函数 panic 后对连接的处理方式
+type PanicPolicy int
+
+const (
+	// PanicKeepConnection 返回失败响应后继续处理该连接的后续消息
+	PanicKeepConnection PanicPolicy = iota
+	// PanicCloseConnection 返回失败响应后关闭该连接
+	PanicCloseConnection
+)
+
+// PanicInfo 处理函数 panic 时的现场信息
+type PanicInfo struct {
+	Route     string
+	UserID    string
+	MessageID uint64
+	Value     any
+	Stack     []byte
+}
+
+// NewPanicInfo 在 recover 处调用 记录当前调用栈
+func NewPanicInfo(route, userID string, messageID uint64, value any) PanicInfo {
+	return PanicInfo{Route: route, UserID: userID, MessageID: messageID, Value: value, Stack: debug.Stack()}
+}
+
+// ReportPanic 通过日志记录 panic 并调用自定义钩子
+func ReportPanic(logger Logger, hook func(PanicInfo), info PanicInfo) {
+	logger.Error("handler panic recovered",
+		"route", info.Route, "user", info.UserID, "id", info.MessageID,
+		"panic", info.Value, "stack", string(info.Stack))
+	if hook != nil {
+		hook(info)
+	}
+}
@@ -0,0 +1,29 @@
+package core
+
+// RateLimit 令牌桶限流参数
+type RateLimit struct {
+	// 每秒补充的令牌数 为 0 表示不限制
+	Rate float64
+	// 桶容量 即允许的突发消息数 小于 1 时按 1 处理
+	Burst int
+}
+
+// RateLimitAction 消息超出限流时的处理方式
+type RateLimitAction int
+
+const (
+	// RateLimitReject 丢弃消息并向对端返回 ErrRateLimited
+	RateLimitReject RateLimitAction = iota
+	// RateLimitDrop 直接丢弃消息 请求方会一直等待到超时
+	RateLimitDrop
+)
+
+// RateLimitStats 是限流的统计数据
+type RateLimitStats struct {
+	// 被限流的消息数
+	Limited uint64
+	// 因多次超出限流而断开的连接数
+	Disconnected uint64
+	// 按路由模式统计的被限流消息数
+	Routes map[string]uint64
+}
@@ -0,0 +1,33 @@
+package core
+
+// HostLeavePolicy 房主离开房间时的处理方式
+type HostLeavePolicy int
+
+const (
+	// HostLeaveClose 关闭房间 成员收到 RouteRoomClosed 推送
+	HostLeaveClose HostLeavePolicy = iota
+	// HostLeaveMigrate 将房主转给剩余成员 成员收到 RouteHostChanged 推送 最后一人离开时关闭房间
+	HostLeaveMigrate
+)
+
+// HostSelector 在房主离开时从剩余成员中选出新房主 candidates 按加入顺序排列
+// 返回 nil 或非成员时改用最早加入的成员
+type HostSelector func(room Room, candidates []User) User
+
+// RoomOptions 创建房间的参数
+type RoomOptions struct {
+	// 人数上限 为 0 表示不限制
+	Capacity int
+	// 加入房间需要的密码 为空表示不需要
+	Password string
+	// 自定义元数据 创建后可以通过 Room.Metadata 读写
+	Metadata map[string]any
+	// 私有房间不出现在 Rooms 和 RoomsByPage 中 只能按 ID 查找
+	Private bool
+	// 创建者 不为 nil 时创建后立即加入并成为房主
+	Creator User
+	// 房主离开时的处理方式 默认关闭房间
+	HostLeave HostLeavePolicy
+	// HostLeaveMigrate 下挑选新房主 为 nil 时选最早加入的成员
+	HostSelector HostSelector
+}
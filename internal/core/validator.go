@@ -0,0 +1,106 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator 在处理函数执行前校验解码后的参数
+type Validator interface {
+	Validate(v any) error
+}
+
+type tagValidator struct {
+	validates []*validator.Validate
+}
+
+// NewTagValidator 按 validate 与 binding 结构体标签校验参数
+// 失败时返回 CodeValidation 错误 Details 以 json 字段名列出不满足的规则
+func NewTagValidator() Validator {
+	v := &tagValidator{}
+	for _, tag := range []string{"validate", "binding"} {
+		validate := validator.New(validator.WithRequiredStructEnabled())
+		validate.SetTagName(tag)
+		validate.RegisterTagNameFunc(jsonFieldName)
+		v.validates = append(v.validates, validate)
+	}
+	return v
+}
+
+func (v *tagValidator) Validate(value any) error {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	details := make(map[string]string)
+	for _, validate := range v.validates {
+		err := validate.Struct(rv.Interface())
+		var fieldErrs validator.ValidationErrors
+		if errors.As(err, &fieldErrs) {
+			for _, fieldErr := range fieldErrs {
+				details[fieldPath(fieldErr.Namespace())] = fieldRule(fieldErr)
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	return &Error{Code: CodeValidation, Message: "validation failed", Details: details}
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// fieldPath 去掉命名空间开头的结构体类型名
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
+
+func fieldRule(fieldErr validator.FieldError) string {
+	if fieldErr.Param() == "" {
+		return fieldErr.Tag()
+	}
+	return fieldErr.Tag() + "=" + fieldErr.Param()
+}
+
+type validatingCodec struct {
+	Codec
+	validator Validator
+}
+
+// WithValidator 返回解码后执行校验的 Codec validator 为 nil 时原样返回
+func WithValidator(codec Codec, validator Validator) Codec {
+	if validator == nil {
+		return codec
+	}
+	return validatingCodec{Codec: codec, validator: validator}
+}
+
+func (c validatingCodec) Unmarshal(data []byte, v any) error {
+	if err := c.Codec.Unmarshal(data, v); err != nil {
+		return err
+	}
+	return c.validator.Validate(v)
+}
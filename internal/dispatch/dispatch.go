@@ -0,0 +1,72 @@
+package dispatch
+
+import (
+	"sync"
+
+	"github.com/zmhuanf/feng/internal/core"
+)
+
+// Dispatcher 在读循环之外执行单个连接的消息处理
+// 已排队与执行中的消息总数受 limit 限制 超过时 Submit 直接拒绝 读循环永不阻塞
+type Dispatcher struct {
+	mode     core.DispatchMode
+	limit    int
+	inflight int
+	queues   map[string][]func()
+	lock     sync.Mutex
+}
+
+func New(mode core.DispatchMode, limit int) *Dispatcher {
+	return &Dispatcher{mode: mode, limit: limit, queues: make(map[string][]func())}
+}
+
+// Submit 提交一条消息的处理任务 key 为消息路由 超过上限时返回 false
+func (d *Dispatcher) Submit(key string, task func()) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.limit > 0 && d.inflight >= d.limit {
+		return false
+	}
+	d.inflight++
+
+	switch d.mode {
+	case core.DispatchConcurrent:
+		go d.run(task)
+		return true
+	case core.DispatchOrdered:
+		key = ""
+	}
+	queue, ok := d.queues[key]
+	d.queues[key] = append(queue, task)
+	if !ok {
+		go d.drain(key)
+	}
+	return true
+}
+
+// drain 按顺序执行同一队列的任务 队列清空后退出
+func (d *Dispatcher) drain(key string) {
+	for {
+		d.lock.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.lock.Unlock()
+			return
+		}
+		task := queue[0]
+		queue[0] = nil
+		d.queues[key] = queue[1:]
+		d.lock.Unlock()
+		d.run(task)
+	}
+}
+
+func (d *Dispatcher) run(task func()) {
+	defer func() {
+		d.lock.Lock()
+		d.inflight--
+		d.lock.Unlock()
+	}()
+	task()
+}
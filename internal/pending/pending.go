@@ -5,9 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/zmhuanf/feng/internal/core"
 )
 
 type Result struct {
@@ -16,7 +17,7 @@ type Result struct {
 }
 
 type Request struct {
-	ID       string
+	ID       uint64
 	Callback any
 	ch       chan Result
 	once     sync.Once
@@ -24,20 +25,21 @@ type Request struct {
 
 type Store struct {
 	timeout time.Duration
-	items   map[string]*Request
+	items   map[uint64]*Request
 	lock    sync.RWMutex
+	nextID  atomic.Uint64
 }
 
 func New(timeout time.Duration) *Store {
 	return &Store{
 		timeout: timeout,
-		items:   make(map[string]*Request),
+		items:   make(map[uint64]*Request),
 	}
 }
 
 func (s *Store) Add(callback any) *Request {
 	req := &Request{
-		ID:       uuid.New().String(),
+		ID:       s.NextID(),
 		Callback: callback,
 		ch:       make(chan Result, 1),
 	}
@@ -47,14 +49,19 @@ func (s *Store) Add(callback any) *Request {
 	return req
 }
 
-func (s *Store) Get(id string) (*Request, bool) {
+// NextID 分配一个消息 ID 推送消息也从这里取号 保证同一链路内不重复
+func (s *Store) NextID() uint64 {
+	return s.nextID.Add(1)
+}
+
+func (s *Store) Get(id uint64) (*Request, bool) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	req, ok := s.items[id]
 	return req, ok
 }
 
-func (s *Store) Delete(id string) {
+func (s *Store) Delete(id uint64) {
 	s.lock.Lock()
 	req, ok := s.items[id]
 	if ok {
@@ -66,7 +73,7 @@ func (s *Store) Delete(id string) {
 	}
 }
 
-func (s *Store) Resolve(id string, result Result) bool {
+func (s *Store) Resolve(id uint64, result Result) bool {
 	s.lock.Lock()
 	req, ok := s.items[id]
 	if ok {
@@ -82,24 +89,34 @@ func (s *Store) Resolve(id string, result Result) bool {
 }
 
 func (s *Store) Wait(ctx context.Context, req *Request) error {
+	_, err := s.WaitResult(ctx, req)
+	return err
+}
+
+// WaitResult 等待应答 没有回调的请求成功时返回未解码的响应载荷
+func (s *Store) WaitResult(ctx context.Context, req *Request) ([]byte, error) {
 	timer := time.NewTimer(s.timeout)
 	defer timer.Stop()
 
 	select {
 	case result, ok := <-req.ch:
 		if !ok {
-			return errors.New("request closed")
+			return nil, errors.New("request closed")
 		}
 		if result.Success {
-			return nil
+			data, _ := result.Data.([]byte)
+			return data, nil
 		}
-		return fmt.Errorf("%v", result.Data)
+		if err, ok := result.Data.(error); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%v", result.Data)
 	case <-ctx.Done():
 		s.Delete(req.ID)
-		return ctx.Err()
+		return nil, ctx.Err()
 	case <-timer.C:
 		s.Delete(req.ID)
-		return errors.New("request timeout")
+		return nil, core.ErrTimeout
 	}
 }
 
@@ -115,10 +132,23 @@ func (s *Store) AutoDelete(req *Request) {
 	}
 }
 
+// Fail 以指定错误结束所有等待中的请求
+func (s *Store) Fail(err error) {
+	s.lock.Lock()
+	items := s.items
+	s.items = make(map[uint64]*Request)
+	s.lock.Unlock()
+
+	for _, req := range items {
+		req.ch <- Result{Success: false, Data: err}
+		req.close()
+	}
+}
+
 func (s *Store) Close() {
 	s.lock.Lock()
 	items := s.items
-	s.items = make(map[string]*Request)
+	s.items = make(map[uint64]*Request)
 	s.lock.Unlock()
 
 	for _, req := range items {
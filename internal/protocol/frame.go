@@ -0,0 +1,156 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Subprotocol 是二进制帧协议在 WebSocket 握手中协商的子协议名
+// 未协商该子协议的连接使用旧版 JSON 信封
+const Subprotocol = "feng.v2"
+
+// FrameVersion 是当前二进制帧的版本号
+const FrameVersion byte = 2
+
+const (
+	FlagSuccess byte = 1 << iota
+	FlagRouteID
+	FlagCompressed
+	FlagError
+)
+
+var (
+	ErrInvalidFrame       = errors.New("protocol: invalid frame")
+	ErrUnsupportedVersion = errors.New("protocol: unsupported frame version")
+)
+
+// Encode 将消息编码为二进制帧
+// 帧格式: 版本(1) 类型(1) 标志(1) 请求ID(uvarint) 路由编号(uvarint) 或 路由长度(uvarint)+路由 [错误码(uvarint) 错误详情] 载荷(剩余字节)
+func Encode(msg *Message) []byte {
+	buf := make([]byte, 0, 3+2*binary.MaxVarintLen64+len(msg.Route)+len(msg.Data))
+	var flags byte
+	if msg.Success {
+		flags |= FlagSuccess
+	}
+	if msg.RouteID != 0 {
+		flags |= FlagRouteID
+	}
+	if msg.Compressed {
+		flags |= FlagCompressed
+	}
+	if msg.Code != 0 {
+		flags |= FlagError
+	}
+	buf = append(buf, FrameVersion, byte(msg.Type), flags)
+	buf = binary.AppendUvarint(buf, msg.ID)
+	if msg.RouteID != 0 {
+		buf = binary.AppendUvarint(buf, uint64(msg.RouteID))
+	} else {
+		buf = binary.AppendUvarint(buf, uint64(len(msg.Route)))
+		buf = append(buf, msg.Route...)
+	}
+	if msg.Code != 0 {
+		buf = binary.AppendUvarint(buf, uint64(msg.Code))
+		buf = appendDetails(buf, msg.Details)
+	}
+	return append(buf, msg.Data...)
+}
+
+// Decode 解析二进制帧 载荷直接引用 data 的底层数组
+func Decode(data []byte) (*Message, error) {
+	if len(data) < 3 {
+		return nil, ErrInvalidFrame
+	}
+	if data[0] != FrameVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	flags := data[2]
+	msg := &Message{Type: MessageType(data[1]), Success: flags&FlagSuccess != 0, Compressed: flags&FlagCompressed != 0}
+	data = data[3:]
+
+	id, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, ErrInvalidFrame
+	}
+	msg.ID = id
+	data = data[n:]
+
+	value, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, ErrInvalidFrame
+	}
+	data = data[n:]
+	if flags&FlagRouteID != 0 {
+		if value == 0 || value > 1<<32-1 {
+			return nil, ErrInvalidFrame
+		}
+		msg.RouteID = uint32(value)
+	} else {
+		if value > uint64(len(data)) {
+			return nil, ErrInvalidFrame
+		}
+		msg.Route = string(data[:value])
+		data = data[value:]
+	}
+	if flags&FlagError != 0 {
+		code, n := binary.Uvarint(data)
+		if n <= 0 || code == 0 || code > 1<<32-1 {
+			return nil, ErrInvalidFrame
+		}
+		msg.Code = uint32(code)
+		var err error
+		if msg.Details, data, err = readDetails(data[n:]); err != nil {
+			return nil, err
+		}
+	}
+	msg.Data = data
+	return msg, nil
+}
+
+// appendDetails 编码错误详情 格式为 项数(uvarint) 后接每项的 键长度(uvarint)+键 值长度(uvarint)+值
+func appendDetails(buf []byte, details map[string]string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(details)))
+	for key, value := range details {
+		buf = appendString(buf, key)
+		buf = appendString(buf, value)
+	}
+	return buf
+}
+
+func readDetails(data []byte) (map[string]string, []byte, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return nil, nil, ErrInvalidFrame
+	}
+	data = data[n:]
+	if count == 0 {
+		return nil, data, nil
+	}
+	details := make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		var key, value string
+		var ok bool
+		if key, data, ok = readString(data); !ok {
+			return nil, nil, ErrInvalidFrame
+		}
+		if value, data, ok = readString(data); !ok {
+			return nil, nil, ErrInvalidFrame
+		}
+		details[key] = value
+	}
+	return details, data, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(data []byte) (string, []byte, bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n) {
+		return "", nil, false
+	}
+	data = data[n:]
+	return string(data[:size]), data[size:], true
+}
@@ -0,0 +1,13 @@
+package protocol
+
+// LegacyMessage 是二进制帧之前使用的 JSON 信封 载荷以字符串形式内嵌
+type LegacyMessage struct {
+	Route   string      `json:"route"`
+	ID      string      `json:"id"`
+	Type    MessageType `json:"type"`
+	Data    string      `json:"data"`
+	Success bool        `json:"success"`
+	// 失败回执的错误码和详情 旧版客户端忽略这两个字段 仍从 data 读取错误描述
+	Code    uint32            `json:"code,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
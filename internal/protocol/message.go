@@ -1,5 +1,26 @@
 package protocol
 
+const (
+	// HeaderResumeToken 在握手请求中携带待恢复会话的令牌 在握手响应中下发当前会话令牌。
+	HeaderResumeToken = "Feng-Resume-Token"
+	// HeaderResumed 在握手响应中标记会话是否为恢复的旧会话。
+	HeaderResumed = "Feng-Resumed"
+	// HeaderCompression 在握手请求中列出客户端支持的载荷压缩算法 在握手响应中返回选定的算法。
+	HeaderCompression = "Feng-Compression"
+)
+
+// RouteAuth 是首条消息握手认证使用的保留路由
+const RouteAuth = "@auth"
+
+// RouteKick 是服务器踢下连接前推送断开原因使用的保留路由
+const RouteKick = "@kick"
+
+// RouteRoomClosed 是房间关闭时向成员推送房间 ID 使用的保留路由
+const RouteRoomClosed = "@room_closed"
+
+// RouteHostChanged 是房主变更时向成员推送新房主 ID 使用的保留路由
+const RouteHostChanged = "@host_changed"
+
 type MessageType int
 
 const (
@@ -7,12 +28,27 @@ const (
 	MessageTypePush
 	MessageTypeRequestBack
 	MessageTypePushBack
+	// 连接建立后告知对端本端已注册路由的编号表
+	MessageTypeRouteTable
 )
 
+// IsBack 判断消息是否为请求或推送的回执
+func (t MessageType) IsBack() bool {
+	return t == MessageTypeRequestBack || t == MessageTypePushBack
+}
+
 type Message struct {
-	Route   string      `json:"route"`
-	ID      string      `json:"id"`
-	Type    MessageType `json:"type"`
-	Data    string      `json:"data"`
-	Success bool        `json:"success"`
+	Route string
+	// 路由编号 非 0 时优先于 Route
+	RouteID uint32
+	ID      uint64
+	Type    MessageType
+	// 由 Codec 编码的载荷
+	Data    []byte
+	Success bool
+	// 载荷是否经过应用层压缩
+	Compressed bool
+	// 失败回执的错误码 此时 Data 为错误描述
+	Code    uint32
+	Details map[string]string
 }
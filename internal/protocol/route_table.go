@@ -0,0 +1,33 @@
+package protocol
+
+import "encoding/binary"
+
+// EncodeRouteTable 编码路由编号表 每项为 编号(uvarint) 路由长度(uvarint) 路由
+func EncodeRouteTable(table map[string]uint32) []byte {
+	buf := make([]byte, 0, len(table)*16)
+	for route, id := range table {
+		buf = binary.AppendUvarint(buf, uint64(id))
+		buf = binary.AppendUvarint(buf, uint64(len(route)))
+		buf = append(buf, route...)
+	}
+	return buf
+}
+
+func DecodeRouteTable(data []byte) (map[string]uint32, error) {
+	table := make(map[string]uint32)
+	for len(data) > 0 {
+		id, n := binary.Uvarint(data)
+		if n <= 0 || id == 0 || id > 1<<32-1 {
+			return nil, ErrInvalidFrame
+		}
+		data = data[n:]
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return nil, ErrInvalidFrame
+		}
+		data = data[n:]
+		table[string(data[:size])] = uint32(id)
+		data = data[size:]
+	}
+	return table, nil
+}
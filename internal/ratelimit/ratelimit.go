@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zmhuanf/feng/internal/core"
+)
+
+// bucket 是令牌桶 按距上次取令牌的时间补充令牌 不依赖定时器
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit core.RateLimit, now time.Time) *bucket {
+	burst := float64(max(limit.Burst, 1))
+	return &bucket{rate: limit.Rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *bucket) allow(now time.Time) bool {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Limiter 是单个用户的限流器 会话恢复和接管后沿用 新旧连接的读循环可能短暂并存
+type Limiter struct {
+	global     *bucket
+	limits     map[string]core.RateLimit
+	routes     map[string]*bucket
+	violations int
+	lock       sync.Mutex
+}
+
+// New 创建限流器 两种限制都未配置时返回 nil
+func New(global core.RateLimit, routes map[string]core.RateLimit) *Limiter {
+	if global.Rate <= 0 && len(routes) == 0 {
+		return nil
+	}
+	l := &Limiter{limits: routes, routes: make(map[string]*bucket)}
+	if global.Rate > 0 {
+		l.global = newBucket(global, time.Now())
+	}
+	return l
+}
+
+// Allow 为一条消息取令牌 pattern 为消息匹配到的路由模式
+// 先检查路由限制 被路由限制拒绝的消息不消耗全局令牌
+func (l *Limiter) Allow(pattern string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	if limit, ok := l.limits[pattern]; ok && limit.Rate > 0 {
+		b, ok := l.routes[pattern]
+		if !ok {
+			b = newBucket(limit, now)
+			l.routes[pattern] = b
+		}
+		if !b.allow(now) {
+			l.violations++
+			return false
+		}
+	}
+	if l.global != nil && !l.global.allow(now) {
+		l.violations++
+		return false
+	}
+	return true
+}
+
+// PerRoute 判断是否配置了路由限制 未配置时调用方无需解析路由模式
+func (l *Limiter) PerRoute() bool { return len(l.limits) > 0 }
+
+// Violations 返回累计超出限流的次数
+func (l *Limiter) Violations() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.violations
+}
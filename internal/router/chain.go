@@ -0,0 +1,47 @@
+package router
+
+import (
+	"reflect"
+
+	"github.com/zmhuanf/feng/internal/core"
+)
+
+// messageContext 是 ServerContext 与 ClientContext 共有的单条消息方法
+type messageContext interface {
+	Payload() []byte
+}
+
+// IsOnion 判断中间件是否为 func(ctx, next func() error) error 形式
+func IsOnion(fn any, contextType reflect.Type) bool {
+	ft := reflect.TypeOf(fn)
+	return ft != nil && ft.Kind() == reflect.Func &&
+		ft.NumIn() == 2 && ft.In(0) == contextType && ft.In(1) == reflect.TypeFor[func() error]() &&
+		ft.NumOut() == 1 && ft.Out(0) == errorType()
+}
+
+// Run 按洋葱模型依次执行中间件 最内层调用 handler
+// 旧形式的中间件在调用后续链之前执行 返回错误时中断
+func Run(middlewares []Middleware, ctx messageContext, codec core.Codec, handler func() error) error {
+	var next func(i int) error
+	next = func(i int) error {
+		if i == len(middlewares) {
+			return handler()
+		}
+		middleware := middlewares[i]
+		if middleware.Onion {
+			rets := reflect.ValueOf(middleware.Fn).Call([]reflect.Value{
+				reflect.ValueOf(ctx),
+				reflect.ValueOf(func() error { return next(i + 1) }),
+			})
+			if rets[0].IsNil() {
+				return nil
+			}
+			return rets[0].Interface().(error)
+		}
+		if _, err := Call(middleware.Fn, ctx, ctx.Payload(), codec); err != nil {
+			return err
+		}
+		return next(i + 1)
+	}
+	return next(0)
+}
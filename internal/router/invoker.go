@@ -34,8 +34,14 @@ func CheckHandler(fn any, contextType reflect.Type) error {
 	return nil
 }
 
+// Func 是已完成类型绑定的处理函数 由泛型注册函数生成 调用时不经过反射
+type Func func(ctx any, data []byte, codec core.Codec) ([]byte, error)
+
 // Call 通过反射调用处理函数并序列化返回值
-func Call(fn any, ctx any, data string, codec core.Codec) (string, error) {
+func Call(fn any, ctx any, data []byte, codec core.Codec) ([]byte, error) {
+	if f, ok := fn.(Func); ok {
+		return f(ctx, data, codec)
+	}
 	fv := reflect.ValueOf(fn)
 	ft := fv.Type()
 
@@ -43,7 +49,7 @@ func Call(fn any, ctx any, data string, codec core.Codec) (string, error) {
 	if ft.NumIn() > 1 {
 		arg, err := decodeArg(ft.In(1), data, codec)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		params = append(params, arg)
 	}
@@ -51,40 +57,63 @@ func Call(fn any, ctx any, data string, codec core.Codec) (string, error) {
 	rets := fv.Call(params)
 	switch len(rets) {
 	case 0:
-		return "", nil
+		return nil, nil
 	case 1:
 		if rets[0].IsNil() {
-			return "", nil
+			return nil, nil
 		}
-		return "", rets[0].Interface().(error)
+		return nil, rets[0].Interface().(error)
 	case 2:
 		if !rets[1].IsNil() {
-			return "", rets[1].Interface().(error)
+			return nil, rets[1].Interface().(error)
 		}
-		bytes, err := codec.Marshal(rets[0].Interface())
+		return codec.Marshal(rets[0].Interface())
+	default:
+		return nil, errors.New("unsupported return values")
+	}
+}
+
+// Decode 按与处理函数参数相同的规则将载荷解码为 T
+// 字符串与字节切片直接转换 其余类型即使载荷为空也交给 codec 仅指针和命名的字符串/字节类型回退到反射
+func Decode[T any](data []byte, codec core.Codec) (T, error) {
+	var result T
+	switch p := any(&result).(type) {
+	case *string:
+		*p = string(data)
+		return result, nil
+	case *[]byte:
+		*p = data
+		return result, nil
+	}
+	switch reflect.TypeFor[T]().Kind() {
+	case reflect.Pointer, reflect.String, reflect.Slice:
+		value, err := decodeArg(reflect.TypeFor[T](), data, codec)
 		if err != nil {
-			return "", err
+			return result, err
 		}
-		return string(bytes), nil
-	default:
-		return "", errors.New("unsupported return values")
+		result, _ = value.Interface().(T)
+		return result, nil
+	}
+	if err := codec.Unmarshal(data, &result); err != nil {
+		return result, decodeError(err)
 	}
+	return result, nil
 }
 
 // decodeArg 将请求数据解码为函数参数所需的 reflect.Value
-func decodeArg(argType reflect.Type, data string, codec core.Codec) (reflect.Value, error) {
+func decodeArg(argType reflect.Type, data []byte, codec core.Codec) (reflect.Value, error) {
 	switch argType.Kind() {
 	case reflect.String:
-		return reflect.ValueOf(data), nil
+		return reflect.ValueOf(string(data)).Convert(argType), nil
 	case reflect.Slice:
 		if argType.Elem().Kind() == reflect.Uint8 {
-			return reflect.ValueOf([]byte(data)), nil
+			return reflect.ValueOf(data).Convert(argType), nil
 		}
 	case reflect.Pointer:
 		// 函数签名就是指针 直接返回构造出的指针本身
 		ptr := reflect.New(argType.Elem())
-		if err := codec.Unmarshal([]byte(data), ptr.Interface()); err != nil {
-			return reflect.Value{}, err
+		if err := codec.Unmarshal(data, ptr.Interface()); err != nil {
+			return reflect.Value{}, decodeError(err)
 		}
 		return ptr, nil
 	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
@@ -93,12 +122,23 @@ func decodeArg(argType reflect.Type, data string, codec core.Codec) (reflect.Val
 	}
 
 	argPtr := reflect.New(argType)
-	if err := codec.Unmarshal([]byte(data), argPtr.Interface()); err != nil {
-		return reflect.Value{}, err
+	if err := codec.Unmarshal(data, argPtr.Interface()); err != nil {
+		return reflect.Value{}, decodeError(err)
 	}
 	return argPtr.Elem(), nil
 }
 
+// decodeError 将载荷解码失败包装为 CodeValidation 使对端能区分非法输入与处理函数的错误
+// 已是结构化错误（如校验失败）时原样返回
+func decodeError(err error) error {
+	var ptr *core.Error
+	var value core.Error
+	if errors.As(err, &ptr) || errors.As(err, &value) {
+		return err
+	}
+	return core.NewError(core.CodeValidation, err.Error())
+}
+
 // supportedPayloadType 判断类型是否可作为请求/响应载荷
 func supportedPayloadType(t reflect.Type) bool {
 	switch t.Kind() {
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
@@ -9,11 +10,18 @@ import (
 type Middleware struct {
 	Route string
 	Fn    any
+	// 是否为 func(ctx, next func() error) error 形式的洋葱中间件
+	Onion    bool
+	segments []string
 }
 
 type Router struct {
 	contextType reflect.Type
-	routes      map[string]any
+	root        *node
+	// 路由编号按首次注册顺序从 1 分配 在路由器生命周期内保持不变
+	// 只有不含参数的静态路由才分配编号
+	ids         map[string]uint32
+	names       []string
 	middlewares []Middleware
 	lock        sync.RWMutex
 }
@@ -21,47 +29,252 @@ type Router struct {
 func New(contextType reflect.Type) *Router {
 	return &Router{
 		contextType: contextType,
-		routes:      make(map[string]any),
+		root:        newNode(),
+		ids:         make(map[string]uint32),
 		middlewares: make([]Middleware, 0),
 	}
 }
 
+// Handle 注册路由 支持 :name 参数段和位于末尾的 *name 通配段
 func (r *Router) Handle(route string, fn any) error {
-	if err := CheckHandler(fn, r.contextType); err != nil {
+	if _, ok := fn.(Func); !ok {
+		if err := CheckHandler(fn, r.contextType); err != nil {
+			return err
+		}
+	}
+	segments := splitRoute(route)
+	if err := checkSegments(route, segments); err != nil {
 		return err
 	}
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	r.routes[route] = fn
+	if err := r.root.insert(route, segments, fn); err != nil {
+		return err
+	}
+	if isStatic(segments) {
+		r.names = append(r.names, route)
+		r.ids[route] = uint32(len(r.names))
+	}
 	return nil
 }
 
+// Route 返回编号对应的路由
+func (r *Router) Route(id uint32) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if id == 0 || int(id) > len(r.names) {
+		return "", false
+	}
+	return r.names[id-1], true
+}
+
+// Resolve 返回消息的路由名 带有已知编号时以编号为准
+func (r *Router) Resolve(route string, id uint32) string {
+	if id != 0 {
+		if name, ok := r.Route(id); ok {
+			return name
+		}
+	}
+	return route
+}
+
+// Table 返回当前所有路由的编号表
+func (r *Router) Table() map[string]uint32 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	table := make(map[string]uint32, len(r.ids))
+	for route, id := range r.ids {
+		table[route] = id
+	}
+	return table
+}
+
+// Use 注册中间件 支持洋葱形式和旧的带载荷形式
 func (r *Router) Use(route string, fn any) error {
-	if err := CheckHandler(fn, r.contextType); err != nil {
+	onion := IsOnion(fn, r.contextType)
+	if !onion {
+		if err := CheckHandler(fn, r.contextType); err != nil {
+			return err
+		}
+	}
+	segments := splitRoute(route)
+	if err := checkSegments(route, segments); err != nil {
 		return err
 	}
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	r.middlewares = append(r.middlewares, Middleware{Route: route, Fn: fn})
+	r.middlewares = append(r.middlewares, Middleware{Route: route, Fn: fn, Onion: onion, segments: segments})
 	return nil
 }
 
-func (r *Router) Handler(route string) (any, bool) {
+// Match 查找路由对应的处理函数 并返回解析出的路径参数
+func (r *Router) Match(route string) (any, map[string]string, bool) {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
-	fn, ok := r.routes[route]
-	return fn, ok
+	params := make(map[string]string)
+	n := r.root.match(splitRoute(route), params)
+	if n == nil {
+		return nil, nil, false
+	}
+	return n.fn, params, true
+}
+
+// Pattern 返回路由匹配到的注册模式 未匹配到处理函数时 ok 为 false
+func (r *Router) Pattern(route string) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if n := r.root.match(splitRoute(route), nil); n != nil {
+		return n.pattern, true
+	}
+	return "", false
 }
 
+// Middlewares 返回作用于该路由的中间件 按路径段匹配 /room 不会匹配 /roomlist
 func (r *Router) Middlewares(route string) []Middleware {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 
+	segments := splitRoute(route)
 	matched := make([]Middleware, 0, len(r.middlewares))
 	for _, middleware := range r.middlewares {
-		if strings.HasPrefix(route, middleware.Route) {
+		if matchPrefix(middleware.segments, segments) {
 			matched = append(matched, middleware)
 		}
 	}
 	return matched
 }
+
+type node struct {
+	static    map[string]*node
+	param     *node
+	paramName string
+	wildcard  *node
+	wildName  string
+	pattern   string
+	fn        any
+}
+
+func newNode() *node {
+	return &node{static: make(map[string]*node)}
+}
+
+func (n *node) insert(route string, segments []string, fn any) error {
+	if len(segments) == 0 {
+		if n.fn != nil {
+			return fmt.Errorf("route %s conflicts with %s", route, n.pattern)
+		}
+		n.pattern = route
+		n.fn = fn
+		return nil
+	}
+	segment := segments[0]
+	switch segment[0] {
+	case ':':
+		name := segment[1:]
+		if n.param == nil {
+			n.param = newNode()
+			n.paramName = name
+		} else if n.paramName != name {
+			return fmt.Errorf("route %s conflicts with parameter :%s", route, n.paramName)
+		}
+		return n.param.insert(route, segments[1:], fn)
+	case '*':
+		name := segment[1:]
+		if n.wildcard != nil {
+			return fmt.Errorf("route %s conflicts with %s", route, n.wildcard.pattern)
+		}
+		n.wildcard = newNode()
+		n.wildName = name
+		n.wildcard.pattern = route
+		n.wildcard.fn = fn
+		return nil
+	default:
+		child, ok := n.static[segment]
+		if !ok {
+			child = newNode()
+			n.static[segment] = child
+		}
+		return child.insert(route, segments[1:], fn)
+	}
+}
+
+// match 按静态段 参数段 通配段的优先级回溯匹配 params 为 nil 时不记录参数
+func (n *node) match(segments []string, params map[string]string) *node {
+	if len(segments) == 0 {
+		if n.fn != nil {
+			return n
+		}
+		return nil
+	}
+	segment := segments[0]
+	if child, ok := n.static[segment]; ok {
+		if found := child.match(segments[1:], params); found != nil {
+			return found
+		}
+	}
+	if n.param != nil {
+		if found := n.param.match(segments[1:], params); found != nil {
+			if params != nil {
+				params[n.paramName] = segment
+			}
+			return found
+		}
+	}
+	if n.wildcard != nil {
+		if params != nil {
+			params[n.wildName] = strings.Join(segments, "/")
+		}
+		return n.wildcard
+	}
+	return nil
+}
+
+func splitRoute(route string) []string {
+	route = strings.Trim(route, "/")
+	if route == "" {
+		return nil
+	}
+	return strings.Split(route, "/")
+}
+
+func checkSegments(route string, segments []string) error {
+	for i, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("route %s has empty segment", route)
+		}
+		if segment[0] != ':' && segment[0] != '*' {
+			continue
+		}
+		if len(segment) == 1 {
+			return fmt.Errorf("route %s has unnamed parameter", route)
+		}
+		if segment[0] == '*' && i != len(segments)-1 {
+			return fmt.Errorf("route %s wildcard must be the last segment", route)
+		}
+	}
+	return nil
+}
+
+func isStatic(segments []string) bool {
+	for _, segment := range segments {
+		if segment[0] == ':' || segment[0] == '*' {
+			return false
+		}
+	}
+	return true
+}
+
+func matchPrefix(prefix, segments []string) bool {
+	for i, segment := range prefix {
+		if segment[0] == '*' {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if segment[0] != ':' && segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zmhuanf/feng/internal/core"
+)
+
+// admission 记录计入限制的连接 内网系统链路不计入
+type admission struct {
+	lock           sync.Mutex
+	active         int
+	perIP          map[string]int
+	rejectedOrigin atomic.Uint64
+	rejectedTotal  atomic.Uint64
+	rejectedPerIP  atomic.Uint64
+}
+
+func newAdmission() *admission {
+	return &admission{perIP: make(map[string]int)}
+}
+
+// admit 检查来源和连接数限制 拒绝时直接响应 HTTP 错误
+// 通过时返回的 release 在连接结束后调用一次
+func (s *Server) admit(ctx *gin.Context) (release func(), ok bool) {
+	if ctx.GetBool(internalSystemKey) {
+		return func() {}, true
+	}
+	a := s.admission
+	ip := ctx.ClientIP()
+	if !s.upgrader.CheckOrigin(ctx.Request) {
+		a.rejectedOrigin.Add(1)
+		s.config.Logger.Warn("connection rejected", "reason", "origin", "origin", ctx.GetHeader("Origin"), "remote", ip)
+		ctx.String(http.StatusForbidden, "origin not allowed")
+		ctx.Abort()
+		return nil, false
+	}
+	a.lock.Lock()
+	reason := ""
+	switch {
+	case s.config.MaxConnections > 0 && a.active >= s.config.MaxConnections:
+		a.rejectedTotal.Add(1)
+		reason = "max connections"
+	case s.config.MaxConnectionsPerIP > 0 && a.perIP[ip] >= s.config.MaxConnectionsPerIP:
+		a.rejectedPerIP.Add(1)
+		reason = "max connections per ip"
+	default:
+		a.active++
+		a.perIP[ip]++
+	}
+	a.lock.Unlock()
+	if reason != "" {
+		s.config.Logger.Warn("connection rejected", "reason", reason, "remote", ip)
+		ctx.String(http.StatusServiceUnavailable, "too many connections")
+		ctx.Abort()
+		return nil, false
+	}
+	return func() {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		a.active--
+		if a.perIP[ip]--; a.perIP[ip] <= 0 {
+			delete(a.perIP, ip)
+		}
+	}, true
+}
+
+func (s *Server) ConnectionStats() core.ConnectionStats {
+	a := s.admission
+	a.lock.Lock()
+	active := a.active
+	a.lock.Unlock()
+	return core.ConnectionStats{
+		Active:         active,
+		RejectedOrigin: a.rejectedOrigin.Load(),
+		RejectedTotal:  a.rejectedTotal.Load(),
+		RejectedPerIP:  a.rejectedPerIP.Load(),
+	}
+}
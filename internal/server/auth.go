@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/protocol"
+	"github.com/zmhuanf/feng/internal/transport"
+)
+
+// authEnabled 判断连接是否需要认证 只有 /game 链路需要
+func (s *Server) authEnabled(isSystem bool) bool {
+	return !isSystem && s.config.Authenticator != nil
+}
+
+func (s *Server) authenticate(ctx *gin.Context, credentials []byte) (string, error) {
+	userID, err := s.config.Authenticator.Authenticate(ctx.Request.Context(), core.AuthRequest{
+		Header:      ctx.Request.Header,
+		Query:       ctx.Request.URL.Query(),
+		RemoteAddr:  ctx.ClientIP(),
+		Credentials: credentials,
+	})
+	if err == nil && userID == "" {
+		err = errors.New("authenticator returned empty user id")
+	}
+	return userID, err
+}
+
+// handshake 读取首条认证消息并回复认证结果 超过 AuthTimeout 未收到时关闭连接
+// verify 在回复成功前对认证出的用户 ID 做额外检查
+func (s *Server) handshake(ctx *gin.Context, ws *transport.Conn, verify func(userID string) error) (string, error) {
+	timer := time.AfterFunc(s.config.AuthTimeout, func() { _ = ws.Close() })
+	msg, err := ws.Read()
+	if !timer.Stop() {
+		return "", context.DeadlineExceeded
+	}
+	if err != nil {
+		return "", err
+	}
+	if msg.Type != protocol.MessageTypeRequest || msg.Route != protocol.RouteAuth {
+		_ = ws.Send(transport.FailMessage(msg.ID, protocol.MessageTypeRequestBack, core.ErrUnauthorized))
+		return "", core.ErrUnauthorized
+	}
+	userID, err := s.authenticate(ctx, msg.Data)
+	if err == nil {
+		err = verify(userID)
+	}
+	if err != nil {
+		_ = ws.Send(transport.FailMessage(msg.ID, protocol.MessageTypeRequestBack, core.AuthError(err)))
+		return "", err
+	}
+	return userID, ws.Send(&protocol.Message{ID: msg.ID, Type: protocol.MessageTypeRequestBack, Data: []byte(userID), Success: true})
+}
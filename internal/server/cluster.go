@@ -1,16 +1,41 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"net"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/zmhuanf/feng/internal/client"
 	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/router"
 )
 
+// 系统链路路由 只有网关查询路由对游戏客户端公开
+const (
+	routeChallenge         = "/challenge"
+	routeJoin              = "/join"
+	routeReportStatus      = "/report_status"
+	routeLowLoadServerAddr = "/get_low_load_server_addr"
+)
+
+// 系统链路连接的附加数据键
+const (
+	extraChallenge = "feng.challenge"
+	extraJoined    = "feng.joined"
+)
+
+// internalSystemKey 标记连接来自 SystemAddr 上的内网监听
+const internalSystemKey = "feng.internal"
+
 type systemJoinReq struct {
-	URL  string `json:"url"`
-	Sign string `json:"sign"`
+	URL       string `json:"url"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+	Sign      string `json:"sign"`
 }
 
 type systemReportStatusReq struct {
@@ -18,18 +43,54 @@ type systemReportStatusReq struct {
 }
 
 func (s *Server) addSystemHandlers() {
-	_ = s.systemData.router.Handle("/join", s.systemJoin)
-	_ = s.systemData.router.Handle("/report_status", s.systemReportStatus)
-	_ = s.systemData.router.Handle("/get_low_load_server_addr", s.systemGetLowLoadServerAddr)
+	_ = s.systemData.router.Use("/", s.systemGuard)
+	_ = s.systemData.router.Handle(routeChallenge, s.systemChallenge)
+	_ = s.systemData.router.Handle(routeJoin, s.systemJoin)
+	_ = s.systemData.router.Handle(routeReportStatus, s.systemReportStatus)
+	_ = s.systemData.router.Handle(routeLowLoadServerAddr, s.systemGetLowLoadServerAddr)
+}
+
+// systemGuard 未通过签名认证的连接只能访问公开路由
+// 配置 SystemAddr 后 公网端口上的连接无法发起认证
+func (s *Server) systemGuard(ctx core.ServerContext, next func() error) error {
+	route := ctx.Route()
+	switch {
+	case route == routeLowLoadServerAddr:
+	case s.config.SystemAddr != "" && !ctx.GinContext().GetBool(internalSystemKey):
+		return core.ErrUnauthorized
+	case route == routeChallenge || route == routeJoin:
+	default:
+		if joined, _ := ctx.User().ExtraData(extraJoined); joined != true {
+			return core.ErrUnauthorized
+		}
+	}
+	return next()
+}
+
+// systemChallenge 为连接生成一次性挑战值 加入请求必须对其签名
+func (s *Server) systemChallenge(ctx core.ServerContext) (string, error) {
+	nonce := core.GenerateRandomKey(16)
+	ctx.User().SetExtraData(extraChallenge, nonce)
+	return nonce, nil
 }
 
 func (s *Server) systemJoin(ctx core.ServerContext, req systemJoinReq) error {
-	if !core.Verify(req.URL, s.config.NetworkSignKey, req.Sign) {
-		return errors.New("invalid sign")
+	// 挑战值只能使用一次 截获的加入请求无法在其他连接上重放
+	nonce, _ := ctx.User().ExtraData(extraChallenge)
+	ctx.User().SetExtraData(extraChallenge, "")
+	if nonce == "" || nonce != req.Nonce {
+		return core.NewError(core.CodeUnauthorized, "invalid challenge")
+	}
+	if skew := time.Since(time.Unix(req.Timestamp, 0)); skew > s.config.NetworkSignWindow || skew < -s.config.NetworkSignWindow {
+		return core.NewError(core.CodeUnauthorized, "sign expired")
 	}
+	if !core.VerifyChallenge(req.URL, req.Timestamp, req.Nonce, s.config.NetworkSignKey, req.Sign) {
+		return core.NewError(core.CodeUnauthorized, "invalid sign")
+	}
+	ctx.User().SetExtraData(extraJoined, true)
 	s.peersLock.Lock()
 	defer s.peersLock.Unlock()
-	s.peers[ctx.User().ID()] = &Status{URL: req.URL, Load: 0, ID: uuid.New().String(), ReportTime: time.Now()}
+	s.peers[ctx.User().ID()] = &core.Status{URL: req.URL, Load: 0, ID: uuid.New().String(), ReportTime: time.Now()}
 	return nil
 }
 
@@ -45,6 +106,142 @@ func (s *Server) systemReportStatus(ctx core.ServerContext, req systemReportStat
 	return nil
 }
 
-func (s *Server) systemGetLowLoadServerAddr(core.ServerContext, bool) (string, error) {
-	return "", nil
+func (s *Server) systemGetLowLoadServerAddr(_ core.ServerContext, needNew bool) (string, error) {
+	if !needNew {
+		return "", nil
+	}
+	status, ok := s.config.Balancer.Pick(s.candidates())
+	if !ok {
+		return "", nil
+	}
+	return status.URL, nil
+}
+
+// candidates 返回所有未过期节点的状态，按 ID 排序以保证轮询等策略顺序稳定。
+func (s *Server) candidates() []core.Status {
+	deadline := time.Now().Add(-s.config.PeerTimeout)
+	s.peersLock.RLock()
+	candidates := make([]core.Status, 0, len(s.peers))
+	for _, status := range s.peers {
+		if status.ReportTime.Before(deadline) {
+			continue
+		}
+		candidates = append(candidates, *status)
+	}
+	s.peersLock.RUnlock()
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].ID < candidates[j].ID })
+	return candidates
+}
+
+func (s *Server) removePeer(id string) {
+	s.peersLock.Lock()
+	defer s.peersLock.Unlock()
+	delete(s.peers, id)
+}
+
+// removeStalePeers 每隔 RemoveInterval 清理超过 PeerTimeout 未上报的节点
+func (s *Server) removeStalePeers(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RemoveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		deadline := time.Now().Add(-s.config.PeerTimeout)
+		s.peersLock.Lock()
+		for id, status := range s.peers {
+			if status.ReportTime.Before(deadline) {
+				delete(s.peers, id)
+				s.config.Logger.Info("remove stale peer", "url", status.URL, "reportTime", status.ReportTime)
+			}
+		}
+		s.peersLock.Unlock()
+	}
+}
+
+// joinNetwork 加入 JoinNetwork 所在的服务器网络 并每隔 ReportInterval 上报负载
+// 连接断开或上报失败时 在下一个周期重新加入
+func (s *Server) joinNetwork(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ReportInterval)
+	defer ticker.Stop()
+
+	var member core.Client
+	defer func() {
+		if member != nil {
+			_ = member.Close()
+		}
+	}()
+	for {
+		if member == nil {
+			c, err := s.dialNetwork(ctx)
+			if err != nil {
+				s.config.Logger.Warn("join network failed", "network", s.config.JoinNetwork, "err", err)
+			}
+			member = c
+		} else if err := s.reportStatus(ctx, member); err != nil {
+			s.config.Logger.Warn("report status failed", "network", s.config.JoinNetwork, "err", err)
+			_ = member.Close()
+			member = nil
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) dialNetwork(ctx context.Context) (core.Client, error) {
+	host, portStr, err := net.SplitHostPort(s.config.JoinNetwork)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	config := core.NewDefaultClientConfig()
+	config.Addr = host
+	config.Port = port
+	config.Codec = s.config.Codec
+	config.Logger = s.config.Logger
+	config.Timeout = s.config.Timeout
+	config.Mode = core.ModeServer
+
+	member := client.New(config)
+	if err := member.Connect(ctx); err != nil {
+		return nil, err
+	}
+	data, err := member.RequestRaw(ctx, routeChallenge, nil)
+	if err != nil {
+		_ = member.Close()
+		return nil, err
+	}
+	nonce, err := router.Decode[string](data, s.config.Codec)
+	if err != nil {
+		_ = member.Close()
+		return nil, err
+	}
+	url, _ := advertiseAddr(s.config)
+	req := systemJoinReq{URL: url, Timestamp: time.Now().Unix(), Nonce: nonce}
+	req.Sign = core.SignChallenge(req.URL, req.Timestamp, req.Nonce, s.config.NetworkSignKey)
+	if err := member.Request(ctx, routeJoin, req, func(core.ClientContext) {}); err != nil {
+		_ = member.Close()
+		return nil, err
+	}
+	if err := s.reportStatus(ctx, member); err != nil {
+		_ = member.Close()
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *Server) reportStatus(ctx context.Context, member core.Client) error {
+	load := s.userData.users.Count()
+	// 上报不应跨越下一个周期 避免连接失效时长时间阻塞
+	ctx, cancel := context.WithTimeout(ctx, s.config.ReportInterval)
+	defer cancel()
+	return member.Request(ctx, routeReportStatus, systemReportStatusReq{Load: load}, func(core.ClientContext) {})
 }
@@ -4,23 +4,23 @@ import (
 	"reflect"
 
 	"github.com/zmhuanf/feng/internal/core"
-	"github.com/zmhuanf/feng/internal/pending"
 	"github.com/zmhuanf/feng/internal/router"
 	"github.com/zmhuanf/feng/internal/session"
 )
 
 type channelData struct {
-	router  *router.Router
-	pending *pending.Store
-	users   *session.UserStore
-	rooms   *session.RoomStoreImpl
+	router *router.Router
+	users  *session.UserStore
+	rooms  *session.RoomStoreImpl
+	// 解码处理函数参数使用的 Codec
+	codec core.Codec
 }
 
-func newChannelData(config core.ServerConfig) *channelData {
+func newChannelData(config core.ServerConfig, codec core.Codec) *channelData {
 	return &channelData{
-		router:  router.New(reflect.TypeFor[core.ServerContext]()),
-		pending: pending.New(config.Timeout),
-		users:   session.NewUserStore(config.PageSize),
-		rooms:   session.NewRoomStore(config.PageSize),
+		codec:  codec,
+		router: router.New(reflect.TypeFor[core.ServerContext]()),
+		users:  session.NewUserStore(config.PageSize),
+		rooms:  session.NewRoomStore(config.PageSize),
 	}
 }
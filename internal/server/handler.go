@@ -1,13 +1,17 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/dispatch"
 	"github.com/zmhuanf/feng/internal/pending"
 	"github.com/zmhuanf/feng/internal/protocol"
+	"github.com/zmhuanf/feng/internal/ratelimit"
 	"github.com/zmhuanf/feng/internal/router"
 	"github.com/zmhuanf/feng/internal/session"
 	"github.com/zmhuanf/feng/internal/transport"
@@ -15,86 +19,297 @@ import (
 
 func (s *Server) handleWebsocket(isSystem bool) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		conn, err := transport.Upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+		release, ok := s.admit(ctx)
+		if !ok {
+			return
+		}
+		defer release()
+
+		var userID string
+		if s.authEnabled(isSystem) && !s.config.AuthHandshake {
+			id, err := s.authenticate(ctx, nil)
+			if err != nil {
+				s.config.Logger.Warn("authentication failed", "remote", ctx.ClientIP(), "err", err)
+				ctx.String(http.StatusUnauthorized, core.AuthError(err).Message)
+				ctx.Abort()
+				return
+			}
+			userID = id
+		}
+
+		resumable := !isSystem && s.config.ResumeTimeout > 0
+		var sess *gameSession
+		var token string
+		header := http.Header{}
+		if resumable {
+			sess = s.claimSession(ctx.GetHeader(protocol.HeaderResumeToken))
+			// 令牌属于其他身份时不恢复
+			if sess != nil && userID != "" && sess.user.ID() != userID {
+				s.releaseSession(sess, nil)
+				sess = nil
+			}
+			token = core.GenerateRandomKey(16)
+			if sess != nil {
+				token = sess.token
+			}
+			header.Set(protocol.HeaderResumeToken, token)
+			header.Set(protocol.HeaderResumed, strconv.FormatBool(sess != nil))
+		}
+		if sess == nil && s.rejectDuplicate(userID, isSystem) {
+			s.config.Logger.Warn("duplicate login rejected", "user", userID, "remote", ctx.ClientIP())
+			ctx.String(http.StatusConflict, core.ErrDuplicateLogin.Message)
+			ctx.Abort()
+			return
+		}
+
+		compressor := transport.NegotiateCompressor(ctx.GetHeader(protocol.HeaderCompression), s.config.Compressor)
+		if compressor != nil {
+			header.Set(protocol.HeaderCompression, compressor.Name())
+		}
+
+		conn, err := s.upgrader.Upgrade(ctx.Writer, ctx.Request, header)
 		if err != nil {
+			if sess != nil {
+				s.releaseSession(sess, nil)
+			}
 			ctx.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		ws := transport.NewConn(conn, s.config.Codec)
-		defer ws.Close()
-
+		ws := transport.NewConn(conn)
+		// 先写出已排队的消息 如踢下线原因和 panic 时的失败回执
+		defer ws.Shutdown()
+		ws.SetWriteTimeout(s.config.WriteTimeout)
+		if s.config.MaxMessageSize > 0 {
+			ws.SetReadLimit(s.config.MaxMessageSize)
+		}
+		ws.SetCompression(compressor, s.config.CompressThreshold)
+		ws.KeepAlive(s.config.PingInterval, s.config.PongTimeout)
+		if s.authEnabled(isSystem) && s.config.AuthHandshake {
+			id, err := s.handshake(ctx, ws, func(id string) error {
+				if sess != nil && sess.user.ID() != id {
+					return errors.New("resume token belongs to another user")
+				}
+				if sess == nil && s.rejectDuplicate(id, isSystem) {
+					return core.ErrDuplicateLogin
+				}
+				return nil
+			})
+			if err != nil {
+				s.config.Logger.Warn("authentication failed", "remote", ctx.ClientIP(), "err", err)
+				if sess != nil {
+					s.releaseSession(sess, nil)
+				}
+				return
+			}
+			userID = id
+		}
 		data := s.channel(isSystem)
-		serverCtx := core.NewServerContext(s, ctx)
-		room := data.rooms.CreateRoom()
-		user := session.NewUser(s, serverCtx, data.rooms, data.pending, ws)
-		serverCtx.Bind(room, user)
-		_ = room.AddUser(user)
-		s.addUser(user, isSystem)
-		defer s.removeUser(user.ID(), isSystem)
+		if err := ws.SendRouteTable(data.router.Table()); err != nil {
+			s.config.Logger.Error("send route table failed", "err", err)
+		}
+
+		var serverCtx *core.BaseServerContext
+		var user *session.User
+		if sess != nil {
+			serverCtx, user = sess.ctx, sess.user
+			serverCtx.BindGin(ctx)
+			s.attachSession(sess, ws)
+		} else if old := s.onlineUser(userID, isSystem); old != nil && s.config.DuplicateLogin == core.DuplicateTakeOver {
+			serverCtx, user = old.Context().(*core.BaseServerContext), old
+			serverCtx.BindGin(ctx)
+			sess = s.takeOver(old, ws, token)
+			s.config.Logger.Info("session taken over", "user", userID, "remote", ctx.ClientIP())
+		} else {
+			if old != nil && s.config.DuplicateLogin == core.DuplicateKick {
+				s.kickUser(old, isSystem)
+				s.config.Logger.Info("previous login kicked", "user", userID, "remote", ctx.ClientIP())
+			}
+			serverCtx = core.NewServerContext(s, ctx)
+			user = session.NewUser(userID, s, serverCtx, data.rooms, pending.New(s.config.Timeout), ws)
+			// 同一用户并发登录时 后加入的连接按重复登录处理
+			if err := s.addUser(user, isSystem); err != nil {
+				s.config.Logger.Warn("add user failed", "user", user.ID(), "err", err)
+				s.kick(ws, core.ErrDuplicateLogin)
+				return
+			}
+			serverCtx.Bind(nil, user)
+			// 限流只作用于 /game 链路 限流器随用户保留 重连和接管不会重置令牌桶
+			if !isSystem {
+				user.SetRateLimiter(ratelimit.New(s.config.RateLimit, s.config.RouteRateLimits))
+			}
+			if resumable {
+				sess = s.addSession(token, serverCtx, user, ws)
+			}
+		}
+		if sess != nil {
+			defer s.releaseSession(sess, ws)
+		} else {
+			defer s.releaseUser(user, ws, isSystem)
+		}
 
+		// 应答类消息在读循环内处理 保证处理函数等待对端应答时不会死锁
+		if s.config.SendQueueSize > 0 {
+			ws.StartWriter(s.config.SendQueueSize, s.config.SendQueuePolicy)
+		}
+		dispatcher := dispatch.New(s.config.DispatchMode, s.config.MaxInFlight)
+		limiter := user.RateLimiter()
 		for {
 			msg, err := ws.Read()
 			if err != nil {
 				s.config.Logger.Error("read message failed", "err", err)
 				return
 			}
-			if err := s.dispatch(serverCtx, ws, data, msg); err != nil {
-				s.config.Logger.Error("dispatch message failed", "err", err)
+			if msg.Type != protocol.MessageTypeRequest && msg.Type != protocol.MessageTypePush {
+				if !s.safeDispatch(serverCtx, ws, data, msg) {
+					return
+				}
+				continue
 			}
+			route := data.router.Resolve(msg.Route, msg.RouteID)
+			if limiter != nil {
+				allowed, keep := s.checkRate(limiter, serverCtx, ws, data, msg, route)
+				if !keep {
+					return
+				}
+				if !allowed {
+					continue
+				}
+			}
+			submitted := dispatcher.Submit(route, func() {
+				if !s.safeDispatch(serverCtx, ws, data, msg) {
+					_ = ws.Shutdown()
+				}
+			})
+			if !submitted {
+				if err := s.failMessage(serverCtx, ws, msg, core.ErrBusy); err != nil {
+					s.config.Logger.Error("send busy response failed", "err", err)
+				}
+			}
+		}
+	}
+}
+
+// safeDispatch 处理单条消息 处理函数 panic 时恢复并按策略决定是否保留连接
+func (s *Server) safeDispatch(ctx core.ServerContext, sender *transport.Conn, data *channelData, msg *protocol.Message) (keep bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			userID := ""
+			if user := ctx.User(); user != nil {
+				userID = user.ID()
+			}
+			core.ReportPanic(s.config.Logger, s.config.OnPanic, core.NewPanicInfo(msg.Route, userID, msg.ID, r))
+			if err := s.failMessage(ctx, sender, msg, core.ErrInternal); err != nil {
+				s.config.Logger.Error("send panic response failed", "err", err)
+			}
+			keep = s.config.PanicPolicy != core.PanicCloseConnection
 		}
+	}()
+	if err := s.dispatch(ctx, sender, data, msg); err != nil {
+		s.config.Logger.Error("dispatch message failed", "err", err)
 	}
+	return true
+}
+
+// failMessage 向对端返回失败响应 或让等待中的请求失败
+func (s *Server) failMessage(ctx core.ServerContext, sender *transport.Conn, msg *protocol.Message, cause error) error {
+	switch msg.Type {
+	case protocol.MessageTypeRequest:
+		return sender.Send(transport.FailMessage(msg.ID, protocol.MessageTypeRequestBack, cause))
+	case protocol.MessageTypePush:
+		return sender.Send(transport.FailMessage(msg.ID, protocol.MessageTypePushBack, cause))
+	case protocol.MessageTypeRequestBack:
+		if store := pendingOf(ctx); store != nil {
+			store.Resolve(msg.ID, pending.Result{Success: false, Data: core.AsError(cause)})
+		}
+	}
+	return nil
 }
 
 func (s *Server) dispatch(ctx core.ServerContext, sender *transport.Conn, data *channelData, msg *protocol.Message) error {
 	switch msg.Type {
 	case protocol.MessageTypePushBack:
 		if !msg.Success {
-			return fmt.Errorf("push back failed, id: %s, data: %s", msg.ID, msg.Data)
+			return fmt.Errorf("push back failed, id: %d, data: %s", msg.ID, msg.Data)
 		}
 		return nil
 	case protocol.MessageTypeRequestBack:
-		return s.handleRequestBack(ctx, data.pending, msg)
+		return s.handleRequestBack(ctx, msg)
 	case protocol.MessageTypePush, protocol.MessageTypeRequest:
-		return s.handleIncoming(ctx, sender, data.router, msg)
+		return s.handleIncoming(ctx, sender, data, msg)
+	case protocol.MessageTypeRouteTable:
+		table, err := protocol.DecodeRouteTable(msg.Data)
+		if err != nil {
+			return err
+		}
+		sender.SetRemoteRoutes(table)
+		return nil
 	default:
 		return fmt.Errorf("unknown message type: %d", msg.Type)
 	}
 }
 
-func (s *Server) handleRequestBack(ctx core.ServerContext, store *pending.Store, msg *protocol.Message) error {
+// pendingOf 返回连接所属用户发出的待应答请求 应答只能完成本用户的请求
+func pendingOf(ctx core.ServerContext) *pending.Store {
+	user, ok := ctx.User().(*session.User)
+	if !ok {
+		return nil
+	}
+	return user.Pending()
+}
+
+func (s *Server) handleRequestBack(ctx core.ServerContext, msg *protocol.Message) error {
+	store := pendingOf(ctx)
+	if store == nil {
+		return fmt.Errorf("response without user, id: %d", msg.ID)
+	}
 	req, ok := store.Get(msg.ID)
 	if !ok {
-		return fmt.Errorf("response not found, id: %s", msg.ID)
+		return fmt.Errorf("response not found, id: %d", msg.ID)
 	}
 	if !msg.Success {
-		store.Resolve(msg.ID, pending.Result{Success: false, Data: msg.Data})
+		store.Resolve(msg.ID, pending.Result{Success: false, Data: transport.MessageError(msg)})
+		return nil
+	}
+	if req.Callback == nil {
+		store.Resolve(msg.ID, pending.Result{Success: true, Data: msg.Data})
 		return nil
 	}
 	if _, err := router.Call(req.Callback, ctx, msg.Data, s.config.Codec); err != nil {
-		store.Resolve(msg.ID, pending.Result{Success: false, Data: err.Error()})
+		store.Resolve(msg.ID, pending.Result{Success: false, Data: core.AsError(err)})
 		return nil
 	}
 	store.Resolve(msg.ID, pending.Result{Success: true})
 	return nil
 }
 
-func (s *Server) handleIncoming(ctx core.ServerContext, sender *transport.Conn, route *router.Router, msg *protocol.Message) error {
+func (s *Server) handleIncoming(ctx core.ServerContext, sender *transport.Conn, data *channelData, msg *protocol.Message) error {
+	route := data.router
 	responseType := protocol.MessageTypeRequestBack
 	if msg.Type == protocol.MessageTypePush {
 		responseType = protocol.MessageTypePushBack
 	}
-	for _, middleware := range route.Middlewares(msg.Route) {
-		if _, err := router.Call(middleware.Fn, ctx, msg.Data, s.config.Codec); err != nil {
-			return sender.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: "middleware error: " + err.Error(), Success: false})
+	if msg.RouteID != 0 {
+		name, ok := route.Route(msg.RouteID)
+		if !ok {
+			return sender.Send(transport.FailMessage(msg.ID, responseType, core.ErrNotFound))
 		}
+		msg.Route = name
 	}
-	fn, ok := route.Handler(msg.Route)
-	if !ok {
-		return sender.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: "route not found", Success: false})
-	}
-	result, err := router.Call(fn, ctx, msg.Data, s.config.Codec)
+	fn, params, ok := route.Match(msg.Route)
+	msgCtx := core.NewServerMessageContext(ctx, msg.Route, params, msg.Data)
+	err := router.Run(route.Middlewares(msg.Route), msgCtx, data.codec, func() error {
+		if !ok {
+			return core.ErrNotFound
+		}
+		result, err := router.Call(fn, msgCtx, msgCtx.Payload(), data.codec)
+		if err != nil {
+			return err
+		}
+		msgCtx.SetResponse(result)
+		return nil
+	})
 	if err != nil {
-		return sender.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: "route error: " + err.Error(), Success: false})
+		return sender.Send(transport.FailMessage(msg.ID, responseType, err))
 	}
-	return sender.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: result, Success: true})
+	return sender.Send(&protocol.Message{ID: msg.ID, Type: responseType, Data: msgCtx.Response(), Success: true})
 }
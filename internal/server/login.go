@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/protocol"
+	"github.com/zmhuanf/feng/internal/session"
+	"github.com/zmhuanf/feng/internal/transport"
+)
+
+// onlineUser 返回同一 ID 的在线用户 未指定 ID 时每个连接都是新用户
+func (s *Server) onlineUser(id string, isSystem bool) *session.User {
+	if id == "" {
+		return nil
+	}
+	user, ok := s.channel(isSystem).users.Get(id)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// rejectDuplicate 判断是否应按 DuplicateReject 拒绝该用户的新连接
+func (s *Server) rejectDuplicate(id string, isSystem bool) bool {
+	return s.config.DuplicateLogin == core.DuplicateReject && s.onlineUser(id, isSystem) != nil
+}
+
+// kick 向连接推送断开原因后关闭连接
+func (s *Server) kick(sender session.Sender, reason *core.Error) {
+	msg := transport.FailMessage(0, protocol.MessageTypePush, reason)
+	msg.Route = protocol.RouteKick
+	_ = sender.Send(msg)
+	_ = sender.Shutdown()
+}
+
+// kickUser 移除用户及其会话 并踢下其连接
+func (s *Server) kickUser(user *session.User, isSystem bool) {
+	s.sessionsLock.Lock()
+	if sess := s.userSessionLocked(user); sess != nil {
+		if sess.timer != nil {
+			sess.timer.Stop()
+		}
+		sess.conn = nil
+		delete(s.sessions, sess.token)
+	}
+	s.sessionsLock.Unlock()
+	s.removeUser(user, isSystem)
+	s.kick(user.Sender(), core.ErrKicked)
+}
+
+// takeOver 将用户及其会话转移到新连接 会话改用新连接的令牌 旧连接被踢下
+func (s *Server) takeOver(user *session.User, conn *transport.Conn, token string) *gameSession {
+	old := user.Sender()
+	s.sessionsLock.Lock()
+	sess := s.userSessionLocked(user)
+	if sess != nil {
+		// 过期计时已触发时 expireSession 会看到新连接而放弃移除
+		if sess.timer != nil {
+			sess.timer.Stop()
+			sess.timer = nil
+		}
+		sess.conn = conn
+		delete(s.sessions, sess.token)
+		sess.token = token
+		s.sessions[token] = sess
+	}
+	s.sessionsLock.Unlock()
+	user.SetSender(conn)
+	s.kick(old, core.ErrKicked)
+	return sess
+}
+
+// releaseUser 在连接断开后移除用户 用户已被新连接接管时跳过
+func (s *Server) releaseUser(user *session.User, conn *transport.Conn, isSystem bool) {
+	if user.Sender() != conn {
+		return
+	}
+	s.removeUser(user, isSystem)
+}
+
+func (s *Server) userSessionLocked(user *session.User) *gameSession {
+	for _, sess := range s.sessions {
+		if sess.user == user {
+			return sess
+		}
+	}
+	return nil
+}
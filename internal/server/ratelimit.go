@@ -0,0 +1,74 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/protocol"
+	"github.com/zmhuanf/feng/internal/ratelimit"
+	"github.com/zmhuanf/feng/internal/transport"
+)
+
+// rateLimitCounters 记录全部连接的限流统计
+type rateLimitCounters struct {
+	limited      atomic.Uint64
+	disconnected atomic.Uint64
+	// 路由模式到 *atomic.Uint64 只在发生限流时写入
+	routes sync.Map
+}
+
+// unmatchedPattern 是未匹配到处理函数的消息共用的统计键 避免客户端用任意路由撑大统计表
+const unmatchedPattern = "<unmatched>"
+
+// routePattern 返回消息匹配到的路由模式 带参数的路由共用同一模式
+func routePattern(data *channelData, route string) string {
+	if pattern, ok := data.router.Pattern(route); ok {
+		return pattern
+	}
+	return unmatchedPattern
+}
+
+// checkRate 检查消息是否超出限流 超出时按 RateLimitAction 处理
+// 返回消息是否继续处理 以及连接是否保留
+func (s *Server) checkRate(limiter *ratelimit.Limiter, ctx core.ServerContext, ws *transport.Conn, data *channelData, msg *protocol.Message, route string) (allowed, keep bool) {
+	pattern := ""
+	if limiter.PerRoute() {
+		pattern = routePattern(data, route)
+	}
+	if limiter.Allow(pattern) {
+		return true, true
+	}
+	if pattern == "" {
+		pattern = routePattern(data, route)
+	}
+	s.rateLimits.limited.Add(1)
+	counter, _ := s.rateLimits.routes.LoadOrStore(pattern, new(atomic.Uint64))
+	counter.(*atomic.Uint64).Add(1)
+
+	if s.config.RateLimitDisconnect > 0 && limiter.Violations() >= s.config.RateLimitDisconnect {
+		s.rateLimits.disconnected.Add(1)
+		s.config.Logger.Warn("rate limit exceeded, disconnecting", "route", pattern, "violations", limiter.Violations())
+		s.kick(ws, core.ErrRateLimited)
+		return false, false
+	}
+	if s.config.RateLimitAction == core.RateLimitReject {
+		if err := s.failMessage(ctx, ws, msg, core.ErrRateLimited); err != nil {
+			s.config.Logger.Error("send rate limit response failed", "err", err)
+		}
+	}
+	return false, true
+}
+
+func (s *Server) RateLimitStats() core.RateLimitStats {
+	stats := core.RateLimitStats{
+		Limited:      s.rateLimits.limited.Load(),
+		Disconnected: s.rateLimits.disconnected.Load(),
+		Routes:       make(map[string]uint64),
+	}
+	s.rateLimits.routes.Range(func(key, value any) bool {
+		stats.Routes[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"time"
+
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/session"
+	"github.com/zmhuanf/feng/internal/transport"
+)
+
+// gameSession 记录一个可在断线后恢复的游戏会话
+type gameSession struct {
+	token string
+	ctx   *core.BaseServerContext
+	user  *session.User
+	// 当前绑定的连接 为 nil 时会话处于断开状态 等待恢复或过期
+	conn  *transport.Conn
+	timer *time.Timer
+}
+
+func (s *Server) addSession(token string, ctx *core.BaseServerContext, user *session.User, conn *transport.Conn) *gameSession {
+	sess := &gameSession{token: token, ctx: ctx, user: user, conn: conn}
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	s.sessions[token] = sess
+	return sess
+}
+
+// claimSession 取出令牌对应的会话并停止其过期计时 会话不存在或正在过期时返回 nil
+func (s *Server) claimSession(token string) *gameSession {
+	if token == "" {
+		return nil
+	}
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	sess, ok := s.sessions[token]
+	if !ok {
+		return nil
+	}
+	if sess.timer != nil {
+		if !sess.timer.Stop() {
+			return nil
+		}
+		sess.timer = nil
+	}
+	return sess
+}
+
+// attachSession 将会话绑定到新连接 旧连接仍存活时将其关闭
+func (s *Server) attachSession(sess *gameSession, conn *transport.Conn) {
+	s.sessionsLock.Lock()
+	old := sess.conn
+	sess.conn = conn
+	s.sessionsLock.Unlock()
+	sess.user.SetSender(conn)
+	if old != nil {
+		_ = old.Close()
+	}
+}
+
+// releaseSession 在连接断开后开始计时 超过 ResumeTimeout 未恢复则移除用户
+func (s *Server) releaseSession(sess *gameSession, conn *transport.Conn) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	// 会话已被新连接接管
+	if sess.conn != conn {
+		return
+	}
+	sess.conn = nil
+	sess.timer = time.AfterFunc(s.config.ResumeTimeout, func() { s.expireSession(sess) })
+}
+
+func (s *Server) expireSession(sess *gameSession) {
+	s.sessionsLock.Lock()
+	if sess.conn != nil {
+		s.sessionsLock.Unlock()
+		return
+	}
+	delete(s.sessions, sess.token)
+	s.sessionsLock.Unlock()
+	s.removeUser(sess.user, false)
+}
@@ -4,49 +4,46 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/zmhuanf/feng/internal/core"
 	"github.com/zmhuanf/feng/internal/session"
+	"github.com/zmhuanf/feng/internal/transport"
 )
 
-type Status struct {
-	URL        string    `json:"url"`
-	Load       int       `json:"load"`
-	ID         string    `json:"id"`
-	ReportTime time.Time `json:"reportTime"`
-}
-
 type Server struct {
-	gin         *gin.Engine
-	config      core.ServerConfig
-	userData    *channelData
-	systemData  *channelData
-	status      Status
-	statusLock  sync.RWMutex
-	peers       map[string]*Status
-	peersLock   sync.RWMutex
-	httpServer  *http.Server
-	serverMutex sync.Mutex
+	gin          *gin.Engine
+	config       core.ServerConfig
+	userData     *channelData
+	systemData   *channelData
+	peers        map[string]*core.Status
+	peersLock    sync.RWMutex
+	httpServer   *http.Server
+	systemServer *http.Server
+	serverMutex  sync.Mutex
+	sessions     map[string]*gameSession
+	sessionsLock sync.Mutex
+	upgrader     *websocket.Upgrader
+	admission    *admission
+	rateLimits   rateLimitCounters
 }
 
 func New(config core.ServerConfig) core.Server {
 	config = core.NormalizeServerConfig(config)
 	s := &Server{
-		config:     config,
-		userData:   newChannelData(config),
-		systemData: newChannelData(config),
-		status: Status{
-			URL:        config.Addr,
-			Load:       0,
-			ID:         uuid.New().String(),
-			ReportTime: time.Now(),
-		},
-		peers: make(map[string]*Status),
+		config: config,
+		// 只对业务链路的处理函数参数执行校验
+		userData:   newChannelData(config, core.WithValidator(config.Codec, config.Validator)),
+		systemData: newChannelData(config, config.Codec),
+		peers:      make(map[string]*core.Status),
+		sessions:   make(map[string]*gameSession),
+		upgrader:   transport.NewUpgrader(config.EnableCompression, config.AllowedOrigins),
+		admission:  newAdmission(),
 	}
 	s.addSystemHandlers()
 	return s
@@ -56,11 +53,21 @@ func (s *Server) Config() *core.ServerConfig { return &s.config }
 
 func (s *Server) Gin() *gin.Engine {
 	if s.gin == nil {
-		s.gin = gin.Default()
+		s.gin = s.newEngine()
 	}
 	return s.gin
 }
 
+// newEngine 创建 gin 引擎 只信任配置的代理转发的客户端 IP 避免伪造请求头绕过按 IP 的限制
+func (s *Server) newEngine() *gin.Engine {
+	engine := gin.Default()
+	if err := engine.SetTrustedProxies(s.config.TrustedProxies); err != nil {
+		s.config.Logger.Error("invalid trusted proxies, forwarded headers ignored", "err", err)
+		_ = engine.SetTrustedProxies(nil)
+	}
+	return engine
+}
+
 func (s *Server) ListenAndServe(ctx context.Context) error {
 	s.serverMutex.Lock()
 	if s.httpServer != nil {
@@ -69,19 +76,39 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 	}
 	engine := s.Gin()
 	engine.GET("/game", s.handleWebsocket(false))
+	// 公网端口保留 /system 以便游戏客户端查询网关
 	engine.GET("/system", s.handleWebsocket(true))
 	s.httpServer = &http.Server{Addr: fmt.Sprintf("%s:%d", s.config.Addr, s.config.Port), Handler: engine}
-	server := s.httpServer
+	servers := []*http.Server{s.httpServer}
+	if s.config.SystemAddr != "" {
+		system := s.newEngine()
+		system.GET("/system", func(ctx *gin.Context) { ctx.Set(internalSystemKey, true) }, s.handleWebsocket(true))
+		s.systemServer = &http.Server{Addr: s.config.SystemAddr, Handler: system}
+		servers = append(servers, s.systemServer)
+	}
 	s.serverMutex.Unlock()
 
-	errCh := make(chan error, 1)
-	go func() {
-		if s.config.CertFile != "" && s.config.KeyFile != "" {
-			errCh <- server.ListenAndServeTLS(s.config.CertFile, s.config.KeyFile)
-			return
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.removeStalePeers(ctx)
+	if s.config.JoinNetwork != "" {
+		if _, ok := advertiseAddr(s.config); ok {
+			go s.joinNetwork(ctx)
+		} else {
+			s.config.Logger.Error("skip joining network: AdvertiseAddr is required when Addr is unspecified", "addr", s.config.Addr, "network", s.config.JoinNetwork)
 		}
-		errCh <- server.ListenAndServe()
-	}()
+	}
+
+	errCh := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			if s.config.CertFile != "" && s.config.KeyFile != "" {
+				errCh <- server.ListenAndServeTLS(s.config.CertFile, s.config.KeyFile)
+				return
+			}
+			errCh <- server.ListenAndServe()
+		}()
+	}
 
 	select {
 	case <-ctx.Done():
@@ -90,18 +117,26 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 		if errors.Is(err, http.ErrServerClosed) {
 			return nil
 		}
+		// 任一监听失败时关闭其余监听
+		_ = s.Stop(context.Background())
 		return err
 	}
 }
 
 func (s *Server) Stop(ctx context.Context) error {
 	s.serverMutex.Lock()
-	server := s.httpServer
-	s.httpServer = nil
+	server, system := s.httpServer, s.systemServer
+	s.httpServer, s.systemServer = nil, nil
 	s.serverMutex.Unlock()
 	if server == nil {
 		return nil
 	}
+	if system != nil {
+		if err := system.Shutdown(ctx); err != nil {
+			_ = server.Shutdown(ctx)
+			return err
+		}
+	}
 	return server.Shutdown(ctx)
 }
 
@@ -119,12 +154,26 @@ func (s *Server) Rooms() []core.Room { return s.userData.rooms.Rooms() }
 
 func (s *Server) RoomsByPage(page int) []core.Room { return s.userData.rooms.RoomsByPage(page) }
 
+// CreateRoom 按参数创建房间 房间只在调用时创建 连接本身不会自动创建房间
+func (s *Server) CreateRoom(options core.RoomOptions) (core.Room, error) {
+	room, err := s.userData.rooms.CreateRoom(options)
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
 func (s *Server) User(id string) (core.User, error) { return s.userData.users.User(id) }
 
 func (s *Server) Users() []core.User { return s.userData.users.Users() }
 
 func (s *Server) UsersByPage(page int) []core.User { return s.userData.users.UsersByPage(page) }
 
+// Multicast 向指定用户推送同一条消息 载荷只编码一次
+func (s *Server) Multicast(route string, data any, userIDs []string) error {
+	return s.userData.users.Multicast(route, data, userIDs)
+}
+
 func (s *Server) channel(isSystem bool) *channelData {
 	if isSystem {
 		return s.systemData
@@ -132,10 +181,31 @@ func (s *Server) channel(isSystem bool) *channelData {
 	return s.userData
 }
 
-func (s *Server) addUser(user *session.User, isSystem bool) {
-	_ = s.channel(isSystem).users.Add(user)
+func (s *Server) addUser(user *session.User, isSystem bool) error {
+	return s.channel(isSystem).users.Add(user)
+}
+
+// removeUser 移除用户 同一 ID 已被新用户占用时不影响新用户
+func (s *Server) removeUser(user *session.User, isSystem bool) {
+	if !s.channel(isSystem).users.Delete(user) {
+		return
+	}
+	if room := user.Room(); room != nil {
+		_ = room.RemoveUser(user)
+	}
+	if isSystem {
+		s.removePeer(user.ID())
+	}
 }
 
-func (s *Server) removeUser(id string, isSystem bool) {
-	_ = s.channel(isSystem).users.Remove(id)
+// advertiseAddr 返回节点对外公布的地址
+// 监听地址未指定（0.0.0.0、:: 或为空）时其他节点无法据此连接 必须显式设置 AdvertiseAddr
+func advertiseAddr(config core.ServerConfig) (string, bool) {
+	if config.AdvertiseAddr != "" {
+		return config.AdvertiseAddr, true
+	}
+	if ip := net.ParseIP(config.Addr); config.Addr == "" || (ip != nil && ip.IsUnspecified()) {
+		return "", false
+	}
+	return net.JoinHostPort(config.Addr, strconv.Itoa(config.Port)), true
 }
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"errors"
+	"maps"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/protocol"
+	"github.com/zmhuanf/feng/internal/transport"
+)
+
+// Multicast 将同一条推送发给多个用户 载荷只编码一次
+// 压缩和帧编码按连接的编码方式各执行一次 部分用户发送失败时返回 *core.MulticastError
+func Multicast(users []*User, route string, data any) error {
+	if len(users) == 0 {
+		return nil
+	}
+	payload, err := users[0].server.Config().Codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// 群发的推送共用一个消息 ID 推送回执只用于记录失败
+	msg := &protocol.Message{ID: users[0].pending.NextID(), Route: route, Type: protocol.MessageTypePush, Data: payload}
+	return fanout(users, transport.NewPrepared(msg))
+}
+
+// fanout 按 CPU 数将用户分组 每组在各自的协程内依次发送
+// 启用发送队列时发送只是入队 分组避免为每个用户创建协程
+func fanout(users []*User, prepared *transport.Prepared) error {
+	groups := min(runtime.GOMAXPROCS(0), len(users))
+	size := (len(users) + groups - 1) / groups
+	var errs map[string]error
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for start := 0; start < len(users); start += size {
+		group := users[start:min(start+size, len(users))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, user := range group {
+				if err := user.getSender().SendPrepared(prepared); err != nil {
+					lock.Lock()
+					if errs == nil {
+						errs = make(map[string]error)
+					}
+					errs[user.ID()] = err
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if errs != nil {
+		return &core.MulticastError{Errors: errs}
+	}
+	return nil
+}
+
+// Broadcast 向房间内所有用户推送
+func (r *Room) Broadcast(route string, data any) error {
+	return r.BroadcastExcept(route, data)
+}
+
+// BroadcastExcept 向房间内除 userIDs 外的所有用户推送
+func (r *Room) BroadcastExcept(route string, data any, userIDs ...string) error {
+	r.lock.RLock()
+	users := make([]*User, 0, len(r.users))
+	for id, user := range r.users {
+		if !slices.Contains(userIDs, id) {
+			users = append(users, user)
+		}
+	}
+	r.lock.RUnlock()
+	return Multicast(users, route, data)
+}
+
+// Multicast 向指定 ID 的在线用户推送 不在线的用户记为 CodeNotFound 错误
+func (s *UserStore) Multicast(route string, data any, userIDs []string) error {
+	users := make([]*User, 0, len(userIDs))
+	missing := make(map[string]error)
+	s.lock.RLock()
+	for _, id := range userIDs {
+		if user, ok := s.users[id]; ok {
+			users = append(users, user)
+		} else {
+			missing[id] = core.NewError(core.CodeNotFound, "user not found")
+		}
+	}
+	s.lock.RUnlock()
+	err := Multicast(users, route, data)
+	if len(missing) == 0 {
+		return err
+	}
+	var multi *core.MulticastError
+	if err == nil {
+		return &core.MulticastError{Errors: missing}
+	}
+	if !errors.As(err, &multi) {
+		return err
+	}
+	maps.Copy(multi.Errors, missing)
+	return multi
+}
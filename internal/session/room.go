@@ -1,13 +1,19 @@
 package session
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/google/uuid"
 	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/protocol"
 )
 
+var errNotMember = errors.New("not a member of the room")
+
 type RoomStore interface {
 	RemoveRoom(id string) error
 }
@@ -15,45 +21,146 @@ type RoomStore interface {
 type Room struct {
 	id    string
 	users map[string]*User
-	lock  sync.RWMutex
-	store RoomStore
-	page  int
-	host  *User
+	// 按加入顺序排列的成员
+	order    []*User
+	lock     sync.RWMutex
+	store    RoomStore
+	page     int
+	host     *User
+	creator  *User
+	capacity int
+	password string
+	private  bool
+	closed   bool
+	metadata map[string]any
+	leave    core.HostLeavePolicy
+	selector core.HostSelector
 }
 
-func NewRoom(store RoomStore) *Room {
-	return &Room{
-		id:    uuid.New().String(),
-		users: make(map[string]*User),
-		store: store,
+func NewRoom(store RoomStore, options core.RoomOptions) *Room {
+	room := &Room{
+		id:       uuid.New().String(),
+		users:    make(map[string]*User),
+		store:    store,
+		capacity: options.Capacity,
+		password: options.Password,
+		private:  options.Private,
+		leave:    options.HostLeave,
+		selector: options.HostSelector,
+		metadata: make(map[string]any, len(options.Metadata)),
 	}
+	maps.Copy(room.metadata, options.Metadata)
+	return room
 }
 
 func (r *Room) ID() string { return r.id }
 
+// RemoveUser 将用户移出房间 房主离开时按 HostLeave 转移房主或关闭房间
 func (r *Room) RemoveUser(user core.User) error {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-
 	u, ok := user.(*User)
 	if !ok {
 		return fmt.Errorf("invalid user type")
 	}
-	if _, ok := r.users[u.ID()]; !ok {
+	r.lock.Lock()
+	if r.users[u.ID()] != u {
+		r.lock.Unlock()
 		return fmt.Errorf("user %s not found", u.ID())
 	}
-	if r.host != nil && r.host.ID() == u.ID() {
-		for _, item := range r.users {
-			item.setRoom(nil)
-		}
-		r.users = make(map[string]*User)
-		return r.store.RemoveRoom(r.id)
-	}
 	delete(r.users, u.ID())
-	u.setRoom(nil)
+	r.order = slices.DeleteFunc(r.order, func(item *User) bool { return item == u })
+	isHost := r.host == u
+	if isHost {
+		r.host = nil
+	}
+	r.lock.Unlock()
+	u.leaveRoom(r)
+	if !isHost {
+		return nil
+	}
+	// 用户已经离开 通知成员失败只记录日志
+	var err error
+	if r.leave == core.HostLeaveMigrate {
+		err = r.migrateHost()
+	} else {
+		err = r.Close()
+	}
+	if err != nil {
+		u.server.Config().Logger.Warn("notify room members failed", "room", r.id, "err", err)
+	}
 	return nil
 }
 
+// migrateHost 从剩余成员中选出新房主 没有成员时关闭房间
+// 选择器在锁外调用 选出的成员随后离开时重新选择 期间加入的用户已成为房主时不再改变
+func (r *Room) migrateHost() error {
+	for {
+		r.lock.RLock()
+		if r.closed || r.host != nil {
+			// 期间有新成员加入成为房主 或房间已被关闭
+			r.lock.RUnlock()
+			return nil
+		}
+		candidates := slices.Clone(r.order)
+		r.lock.RUnlock()
+		if len(candidates) == 0 {
+			return r.Close()
+		}
+		next := candidates[0]
+		if r.selector != nil {
+			users := make([]core.User, len(candidates))
+			for i, user := range candidates {
+				users[i] = user
+			}
+			if chosen, ok := r.selector(r, users).(*User); ok && slices.Contains(candidates, chosen) {
+				next = chosen
+			}
+		}
+		if err := r.assignHost(next, true); !errors.Is(err, errNotMember) {
+			return err
+		}
+	}
+}
+
+// Host 返回房主 房间已关闭或正在转移房主时为 nil
+func (r *Room) Host() core.User {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.host == nil {
+		return nil
+	}
+	return r.host
+}
+
+// SetHost 将房主转给房间内的成员 并向所有成员推送 RouteHostChanged
+func (r *Room) SetHost(user core.User) error {
+	u, ok := user.(*User)
+	if !ok {
+		return fmt.Errorf("invalid user type")
+	}
+	return r.assignHost(u, false)
+}
+
+// assignHost 设置房主并通知成员 vacant 为 true 时只在房主空缺时设置
+func (r *Room) assignHost(u *User, vacant bool) error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return core.ErrRoomClosed
+	}
+	if r.users[u.ID()] != u {
+		r.lock.Unlock()
+		return fmt.Errorf("user %s: %w", u.ID(), errNotMember)
+	}
+	if r.host == u || (vacant && r.host != nil) {
+		r.lock.Unlock()
+		return nil
+	}
+	r.host = u
+	users := slices.Clone(r.order)
+	r.lock.Unlock()
+	return Multicast(users, protocol.RouteHostChanged, u.ID())
+}
+
 func (r *Room) User(id string) (core.User, error) {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
@@ -84,15 +191,101 @@ func (r *Room) Page() int { return r.page }
 
 func (r *Room) SetPage(page int) { r.page = page }
 
-func (r *Room) AddUser(user *User) error {
+func (r *Room) Capacity() int { return r.capacity }
+
+func (r *Room) Private() bool { return r.private }
+
+// Creator 返回创建者 没有指定创建者时为 nil
+func (r *Room) Creator() core.User {
+	if r.creator == nil {
+		return nil
+	}
+	return r.creator
+}
+
+func (r *Room) Metadata(key string) (any, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	value, ok := r.metadata[key]
+	return value, ok
+}
+
+func (r *Room) SetMetadata(key string, value any) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	if _, ok := r.users[user.ID()]; ok {
-		return fmt.Errorf("user %s already exists", user.ID())
+	r.metadata[key] = value
+}
+
+// Close 关闭房间 向所有成员推送 RouteRoomClosed 后将其移出并从房间列表中删除
+// 推送失败时返回 *core.MulticastError 房间仍会关闭
+func (r *Room) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return core.ErrRoomClosed
+	}
+	r.closed = true
+	users := make([]*User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
 	}
+	r.users = make(map[string]*User)
+	r.order = nil
+	r.host = nil
+	r.lock.Unlock()
+
+	for _, user := range users {
+		user.leaveRoom(r)
+	}
+	_ = r.store.RemoveRoom(r.id)
+	return Multicast(users, protocol.RouteRoomClosed, r.id)
+}
+
+func (r *Room) Closed() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.closed
+}
+
+// AddUser 将用户加入房间 第一个加入的用户成为房主
+func (r *Room) AddUser(user *User, password string) error {
+	r.lock.Lock()
+	if err := r.admitLocked(user, password); err != nil {
+		r.lock.Unlock()
+		return err
+	}
+	// 转移房主期间加入的用户直接成为房主 需要告知已有成员
+	notify := r.host == nil && len(r.users) > 0
 	if r.host == nil {
 		r.host = user
 	}
 	r.users[user.ID()] = user
+	r.order = append(r.order, user)
+	var users []*User
+	if notify {
+		users = slices.Clone(r.order)
+	}
+	r.lock.Unlock()
+	if notify {
+		if err := Multicast(users, protocol.RouteHostChanged, user.ID()); err != nil {
+			user.server.Config().Logger.Warn("notify room members failed", "room", r.id, "err", err)
+		}
+	}
+	return nil
+}
+
+func (r *Room) admitLocked(user *User, password string) error {
+	if r.closed {
+		return core.ErrRoomClosed
+	}
+	if _, ok := r.users[user.ID()]; ok {
+		return fmt.Errorf("user %s already exists", user.ID())
+	}
+	if r.password != "" && password != r.password {
+		return core.ErrRoomPassword
+	}
+	if r.capacity > 0 && len(r.users) >= r.capacity {
+		return core.ErrRoomFull
+	}
 	return nil
 }
@@ -22,10 +22,28 @@ func NewRoomStore(pageSize int) *RoomStoreImpl {
 	}
 }
 
-func (s *RoomStoreImpl) CreateRoom() *Room {
-	room := NewRoom(s)
-	_ = s.AddRoom(room)
-	return room
+// CreateRoom 创建房间 指定创建者时创建者随即加入并成为房主
+func (s *RoomStoreImpl) CreateRoom(options core.RoomOptions) (*Room, error) {
+	var creator *User
+	if options.Creator != nil {
+		u, ok := options.Creator.(*User)
+		if !ok {
+			return nil, errors.New("invalid user type")
+		}
+		creator = u
+	}
+	room := NewRoom(s, options)
+	room.creator = creator
+	if err := s.AddRoom(room); err != nil {
+		return nil, err
+	}
+	if creator != nil {
+		if err := creator.JoinRoomWithPassword(room, options.Password); err != nil {
+			_ = s.RemoveRoom(room.ID())
+			return nil, err
+		}
+	}
+	return room, nil
 }
 
 func (s *RoomStoreImpl) AddRoom(room *Room) error {
@@ -35,6 +53,11 @@ func (s *RoomStoreImpl) AddRoom(room *Room) error {
 		return errors.New("room already exists")
 	}
 	s.rooms[room.ID()] = room
+	// 私有房间不参与分页
+	if room.Private() {
+		room.SetPage(-1)
+		return nil
+	}
 	page := s.nextPageLocked()
 	if s.index[page] == nil {
 		s.index[page] = make(map[string]*Room)
@@ -59,7 +82,9 @@ func (s *RoomStoreImpl) Rooms() []core.Room {
 	defer s.lock.RUnlock()
 	rooms := make([]core.Room, 0, len(s.rooms))
 	for _, room := range s.rooms {
-		rooms = append(rooms, room)
+		if !room.Private() {
+			rooms = append(rooms, room)
+		}
 	}
 	return rooms
 }
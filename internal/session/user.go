@@ -5,16 +5,24 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/zmhuanf/feng/internal/core"
 	"github.com/zmhuanf/feng/internal/pending"
 	"github.com/zmhuanf/feng/internal/protocol"
+	"github.com/zmhuanf/feng/internal/ratelimit"
 	"github.com/zmhuanf/feng/internal/router"
+	"github.com/zmhuanf/feng/internal/transport"
 )
 
 type Sender interface {
 	Send(*protocol.Message) error
+	SendDroppable(msg *protocol.Message, key string) error
+	SendPrepared(*transport.Prepared) error
+	RTT() time.Duration
+	QueueDepth() int
+	Shutdown() error
 }
 
 type User struct {
@@ -25,14 +33,19 @@ type User struct {
 	pending *pending.Store
 	sender  Sender
 	room    *Room
+	limiter *ratelimit.Limiter
 	page    int
 	lock    sync.RWMutex
 	extra   sync.Map
 }
 
-func NewUser(server core.Server, ctx core.ServerContext, rooms *RoomStoreImpl, pending *pending.Store, sender Sender) *User {
+// NewUser 创建用户 id 为空时生成随机 ID
+func NewUser(id string, server core.Server, ctx core.ServerContext, rooms *RoomStoreImpl, pending *pending.Store, sender Sender) *User {
+	if id == "" {
+		id = uuid.New().String()
+	}
 	return &User{
-		id:      uuid.New().String(),
+		id:      id,
 		ctx:     ctx,
 		server:  server,
 		rooms:   rooms,
@@ -46,24 +59,48 @@ func (u *User) ID() string { return u.id }
 func (u *User) Room() core.Room {
 	u.lock.RLock()
 	defer u.lock.RUnlock()
+	if u.room == nil {
+		return nil
+	}
 	return u.room
 }
 
+// JoinRoom 加入没有密码的房间 已在其他房间时先离开原房间
 func (u *User) JoinRoom(room core.Room) error {
+	return u.JoinRoomWithPassword(room, "")
+}
+
+// JoinRoomWithPassword 使用密码加入房间 加入失败时仍留在原房间
+func (u *User) JoinRoomWithPassword(room core.Room, password string) error {
 	r, ok := room.(*Room)
 	if !ok {
 		return fmt.Errorf("invalid room type")
 	}
-	if err := r.AddUser(u); err != nil {
+	u.lock.RLock()
+	current := u.room
+	u.lock.RUnlock()
+	if current == r {
+		return nil
+	}
+	if err := r.AddUser(u, password); err != nil {
 		return err
 	}
+	if current != nil {
+		_ = current.RemoveUser(u)
+	}
 	u.setRoom(r)
-	u.setPage(r.Page())
+	// 加入期间房间被关闭时 Close 看不到该用户的所在房间
+	if r.Closed() {
+		u.leaveRoom(r)
+		return core.ErrRoomClosed
+	}
 	return nil
 }
 
+// CreateAndJoinRoom 创建默认参数的房间并成为房主
 func (u *User) CreateAndJoinRoom() error {
-	return u.JoinRoom(u.rooms.CreateRoom())
+	_, err := u.rooms.CreateRoom(core.RoomOptions{Creator: u})
+	return err
 }
 
 func (u *User) LeaveRoom() error {
@@ -78,20 +115,50 @@ func (u *User) LeaveRoom() error {
 
 func (u *User) Context() core.ServerContext { return u.ctx }
 
+// RateLimiter 返回用户的限流器 未启用限流时为 nil
+func (u *User) RateLimiter() *ratelimit.Limiter {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+	return u.limiter
+}
+
+func (u *User) SetRateLimiter(limiter *ratelimit.Limiter) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.limiter = limiter
+}
+
+// Pending 返回该用户发出的待应答请求 每个用户独立编号 应答无法完成其他用户的请求
+func (u *User) Pending() *pending.Store { return u.pending }
+
 func (u *User) ExtraData(key string) (any, bool) { return u.extra.Load(key) }
 
 func (u *User) SetExtraData(key string, value any) { u.extra.Store(key, value) }
 
 func (u *User) Page() int { return u.page }
 
+func (u *User) RTT() time.Duration { return u.getSender().RTT() }
+
 func (u *User) Push(route string, data any) error {
 	bytes, err := u.server.Config().Codec.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return u.sender.Send(&protocol.Message{ID: uuid.New().String(), Route: route, Type: protocol.MessageTypePush, Data: string(bytes)})
+	return u.getSender().Send(&protocol.Message{ID: u.pending.NextID(), Route: route, Type: protocol.MessageTypePush, Data: bytes})
 }
 
+// PushDroppable 发送可丢弃的推送 发送队列满时可被丢弃 key 非空时可被同 key 的新推送合并
+func (u *User) PushDroppable(route string, data any, key string) error {
+	bytes, err := u.server.Config().Codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return u.getSender().SendDroppable(&protocol.Message{ID: u.pending.NextID(), Route: route, Type: protocol.MessageTypePush, Data: bytes}, key)
+}
+
+// SendQueueDepth 返回发送队列中等待写出的消息数
+func (u *User) SendQueueDepth() int { return u.getSender().QueueDepth() }
+
 func (u *User) RequestAsync(route string, data any, callback any) error {
 	if err := router.CheckHandler(callback, reflect.TypeFor[core.ServerContext]()); err != nil {
 		return err
@@ -113,12 +180,38 @@ func (u *User) Request(ctx context.Context, route string, data any, callback any
 	return u.pending.Wait(ctx, req)
 }
 
-func (u *User) sendRequest(id, route string, data any) error {
+// RequestRaw 向客户端发送请求并返回未解码的响应载荷
+func (u *User) RequestRaw(ctx context.Context, route string, data any) ([]byte, error) {
+	req := u.pending.Add(nil)
+	if err := u.sendRequest(req.ID, route, data); err != nil {
+		u.pending.Delete(req.ID)
+		return nil, err
+	}
+	return u.pending.WaitResult(ctx, req)
+}
+
+func (u *User) sendRequest(id uint64, route string, data any) error {
 	bytes, err := u.server.Config().Codec.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return u.sender.Send(&protocol.Message{ID: id, Route: route, Type: protocol.MessageTypeRequest, Data: string(bytes)})
+	return u.getSender().Send(&protocol.Message{ID: id, Route: route, Type: protocol.MessageTypeRequest, Data: bytes})
+}
+
+// SetSender 在会话恢复后将用户绑定到新连接
+func (u *User) SetSender(sender Sender) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.sender = sender
+}
+
+// Sender 返回用户当前绑定的连接
+func (u *User) Sender() Sender { return u.getSender() }
+
+func (u *User) getSender() Sender {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+	return u.sender
 }
 
 func (u *User) setRoom(room *Room) {
@@ -127,4 +220,13 @@ func (u *User) setRoom(room *Room) {
 	u.room = room
 }
 
+// leaveRoom 在用户仍处于 room 时清除所在房间 已加入其他房间时不受影响
+func (u *User) leaveRoom(room *Room) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.room == room {
+		u.room = nil
+	}
+}
+
 func (u *User) setPage(page int) { u.page = page }
@@ -48,6 +48,14 @@ func (s *UserStore) User(id string) (core.User, error) {
 	return user, nil
 }
 
+// Get 返回在线用户的具体类型
+func (s *UserStore) Get(id string) (*User, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	user, ok := s.users[id]
+	return user, ok
+}
+
 func (s *UserStore) Users() []core.User {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
@@ -68,6 +76,12 @@ func (s *UserStore) UsersByPage(page int) []core.User {
 	return users
 }
 
+func (s *UserStore) Count() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.users)
+}
+
 func (s *UserStore) Remove(id string) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -80,6 +94,18 @@ func (s *UserStore) Remove(id string) error {
 	return nil
 }
 
+// Delete 移除指定用户 同一 ID 已被其他用户占用时不做处理
+func (s *UserStore) Delete(user *User) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.users[user.ID()] != user {
+		return false
+	}
+	delete(s.users, user.ID())
+	delete(s.index[user.Page()], user.ID())
+	return true
+}
+
 func (s *UserStore) nextPageLocked() int {
 	for page := 0; ; page++ {
 		if len(s.index[page]) < s.pageSize {
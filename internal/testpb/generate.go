@@ -0,0 +1,4 @@
+// Package testpb 提供测试用的 protobuf 消息。
+package testpb
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative internal/testpb/test.proto
@@ -0,0 +1,140 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: internal/testpb/test.proto
+
+package testpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Player struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Level         int32                  `protobuf:"varint,2,opt,name=level,proto3" json:"level,omitempty"`
+	Items         []string               `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Player) Reset() {
+	*x = Player{}
+	mi := &file_internal_testpb_test_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Player) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Player) ProtoMessage() {}
+
+func (x *Player) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_testpb_test_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Player.ProtoReflect.Descriptor instead.
+func (*Player) Descriptor() ([]byte, []int) {
+	return file_internal_testpb_test_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Player) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Player) GetLevel() int32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *Player) GetItems() []string {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+var File_internal_testpb_test_proto protoreflect.FileDescriptor
+
+const file_internal_testpb_test_proto_rawDesc = "" +
+	"\n" +
+	"\x1ainternal/testpb/test.proto\x12\tfeng.test\"H\n" +
+	"\x06Player\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05level\x18\x02 \x01(\x05R\x05level\x12\x14\n" +
+	"\x05items\x18\x03 \x03(\tR\x05itemsB)Z'github.com/zmhuanf/feng/internal/testpbb\x06proto3"
+
+var (
+	file_internal_testpb_test_proto_rawDescOnce sync.Once
+	file_internal_testpb_test_proto_rawDescData []byte
+)
+
+func file_internal_testpb_test_proto_rawDescGZIP() []byte {
+	file_internal_testpb_test_proto_rawDescOnce.Do(func() {
+		file_internal_testpb_test_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_testpb_test_proto_rawDesc), len(file_internal_testpb_test_proto_rawDesc)))
+	})
+	return file_internal_testpb_test_proto_rawDescData
+}
+
+var file_internal_testpb_test_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_internal_testpb_test_proto_goTypes = []any{
+	(*Player)(nil), // 0: feng.test.Player
+}
+var file_internal_testpb_test_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_internal_testpb_test_proto_init() }
+func file_internal_testpb_test_proto_init() {
+	if File_internal_testpb_test_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_testpb_test_proto_rawDesc), len(file_internal_testpb_test_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_internal_testpb_test_proto_goTypes,
+		DependencyIndexes: file_internal_testpb_test_proto_depIdxs,
+		MessageInfos:      file_internal_testpb_test_proto_msgTypes,
+	}.Build()
+	File_internal_testpb_test_proto = out.File
+	file_internal_testpb_test_proto_goTypes = nil
+	file_internal_testpb_test_proto_depIdxs = nil
+}
@@ -0,0 +1,21 @@
+package transport
+
+import (
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/protocol"
+)
+
+// FailMessage 构造携带结构化错误的失败回执 错误描述放在载荷中以兼容旧版客户端
+func FailMessage(id uint64, messageType protocol.MessageType, err error) *protocol.Message {
+	e := core.AsError(err)
+	return &protocol.Message{ID: id, Type: messageType, Data: []byte(e.Message), Code: uint32(e.Code), Details: e.Details}
+}
+
+// MessageError 还原失败回执中的结构化错误 对端未携带错误码时使用 CodeUnknown
+func MessageError(msg *protocol.Message) *core.Error {
+	code := core.ErrorCode(msg.Code)
+	if code == 0 {
+		code = core.CodeUnknown
+	}
+	return &core.Error{Code: code, Message: string(msg.Data), Details: msg.Details}
+}
@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/zmhuanf/feng/internal/protocol"
+)
+
+// maxLegacyIDs 是等待回执的旧版消息 ID 上限
+// 被限流丢弃等不会回执的消息按先后顺序淘汰 避免映射随连接时长增长
+const maxLegacyIDs = 4096
+
+// legacyIDs 在旧版 JSON 信封与消息之间转换
+// 旧版客户端使用任意字符串作为消息 ID 收到对端发起的消息时分配本地数字 ID 并在回执中还原
+type legacyIDs struct {
+	next uint64
+	ids  map[uint64]string
+	lock sync.Mutex
+}
+
+func newLegacyIDs() *legacyIDs {
+	return &legacyIDs{ids: make(map[uint64]string)}
+}
+
+func (l *legacyIDs) decode(data []byte) (*protocol.Message, error) {
+	var legacy protocol.LegacyMessage
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	msg := &protocol.Message{Route: legacy.Route, Type: legacy.Type, Data: []byte(legacy.Data), Success: legacy.Success, Code: legacy.Code, Details: legacy.Details}
+	if legacy.Type.IsBack() {
+		// 回执对应本端发出的消息 ID 为本端生成的数字
+		id, err := strconv.ParseUint(legacy.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid back message id: %s", legacy.ID)
+		}
+		msg.ID = id
+		return msg, nil
+	}
+	l.lock.Lock()
+	l.next++
+	msg.ID = l.next
+	l.ids[msg.ID] = legacy.ID
+	// 本地 ID 连续分配 超出上限时淘汰最早的一条
+	if msg.ID > maxLegacyIDs {
+		delete(l.ids, msg.ID-maxLegacyIDs)
+	}
+	l.lock.Unlock()
+	return msg, nil
+}
+
+func (l *legacyIDs) encode(msg *protocol.Message) ([]byte, error) {
+	id := strconv.FormatUint(msg.ID, 10)
+	if msg.Type.IsBack() {
+		l.lock.Lock()
+		if original, ok := l.ids[msg.ID]; ok {
+			id = original
+			delete(l.ids, msg.ID)
+		}
+		l.lock.Unlock()
+	}
+	return json.Marshal(protocol.LegacyMessage{Route: msg.Route, ID: id, Type: msg.Type, Data: string(msg.Data), Success: msg.Success, Code: msg.Code, Details: msg.Details})
+}
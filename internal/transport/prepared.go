@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"sync"
+
+	"github.com/zmhuanf/feng/internal/core"
+	"github.com/zmhuanf/feng/internal/protocol"
+)
+
+// Prepared 是发给多个连接的同一条消息 按连接的编码方式缓存编码结果
+// 压缩算法 路由编号和信封格式相同的连接共用同一帧 压缩和帧编码只执行一次
+type Prepared struct {
+	msg    *protocol.Message
+	frames map[preparedKey]*preparedFrame
+	lock   sync.Mutex
+}
+
+type preparedKey struct {
+	legacy     bool
+	compressor core.Compressor
+	threshold  int
+	routeID    uint32
+}
+
+type preparedFrame struct {
+	once  sync.Once
+	frame outbound
+	err   error
+}
+
+// NewPrepared 包装待群发的消息 消息在发送期间不可修改
+func NewPrepared(msg *protocol.Message) *Prepared {
+	return &Prepared{msg: msg, frames: make(map[preparedKey]*preparedFrame)}
+}
+
+// SendPrepared 发送群发消息 首个使用某种编码方式的连接负责编码 其余连接直接复用
+func (c *Conn) SendPrepared(p *Prepared) error {
+	key := preparedKey{legacy: c.legacy != nil}
+	if !key.legacy {
+		key.compressor, key.threshold = c.compressor, c.threshold
+		key.routeID = c.compressRoute(p.msg).RouteID
+	}
+	p.lock.Lock()
+	entry, ok := p.frames[key]
+	if !ok {
+		entry = &preparedFrame{}
+		p.frames[key] = entry
+	}
+	p.lock.Unlock()
+	entry.once.Do(func() { entry.frame, entry.err = c.encode(p.msg) })
+	if entry.err != nil {
+		return entry.err
+	}
+	return c.sendFrame(entry.frame, false, "")
+}
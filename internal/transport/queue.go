@@ -0,0 +1,163 @@
+package transport
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/zmhuanf/feng/internal/core"
+)
+
+// ErrSendQueueFull 表示发送队列已满且没有可丢弃的推送 连接随即被关闭
+var ErrSendQueueFull = errors.New("send queue full")
+
+var errConnClosed = errors.New("connection closed")
+
+// outbound 是编码完成 等待写出的一帧
+type outbound struct {
+	messageType int
+	data        []byte
+	droppable   bool
+	key         string
+	// 写到该标记时关闭连接
+	close bool
+}
+
+type sendQueue struct {
+	size   int
+	policy core.SendQueuePolicy
+	items  []outbound
+	closed bool
+	signal chan struct{}
+	lock   sync.Mutex
+}
+
+// StartWriter 启用容量为 size 的发送队列 由独立的写协程按顺序写出
+// 之后 Send 只负责入队 不会阻塞在对端的 TCP 缓冲区上
+func (c *Conn) StartWriter(size int, policy core.SendQueuePolicy) {
+	q := &sendQueue{size: size, policy: policy, signal: make(chan struct{}, 1)}
+	c.queue.Store(q)
+	go q.run(c)
+}
+
+// QueueDepth 返回发送队列中等待写出的消息数 未启用队列时为 0
+func (c *Conn) QueueDepth() int {
+	q := c.queue.Load()
+	if q == nil {
+		return 0
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
+}
+
+func (q *sendQueue) push(c *Conn, frame outbound) error {
+	select {
+	case <-c.done:
+		return errConnClosed
+	default:
+	}
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return errConnClosed
+	}
+	if len(q.items) >= q.size {
+		keep, ok := q.overflow(frame)
+		if !ok {
+			q.closed = true
+			q.items = nil
+			q.lock.Unlock()
+			_ = c.Close()
+			return ErrSendQueueFull
+		}
+		if !keep {
+			q.lock.Unlock()
+			return nil
+		}
+	}
+	q.items = append(q.items, frame)
+	q.lock.Unlock()
+	q.wake()
+	return nil
+}
+
+// overflow 在队列已满时按策略腾出位置
+// keep 表示新消息是否仍需入队 ok 为 false 表示只能断开连接
+func (q *sendQueue) overflow(frame outbound) (keep, ok bool) {
+	if q.policy == core.SendQueueDisconnect {
+		return false, false
+	}
+	if q.policy == core.SendQueueCoalesce && frame.droppable && frame.key != "" {
+		for i := range q.items {
+			if q.items[i].droppable && q.items[i].key == frame.key {
+				q.items[i] = frame
+				return false, true
+			}
+		}
+	}
+	for i := range q.items {
+		if q.items[i].droppable {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return true, true
+		}
+	}
+	// 队列中全是必须保留的消息 丢弃新的可丢弃推送
+	return false, frame.droppable
+}
+
+// shutdown 追加关闭标记 已排队的消息写出后关闭连接
+func (q *sendQueue) shutdown(c *Conn) error {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.items = append(q.items, outbound{close: true})
+	q.lock.Unlock()
+	q.wake()
+	return nil
+}
+
+func (q *sendQueue) wake() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *sendQueue) run(c *Conn) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-q.signal:
+		}
+		for {
+			q.lock.Lock()
+			if len(q.items) == 0 {
+				q.lock.Unlock()
+				break
+			}
+			frame := q.items[0]
+			q.items[0] = outbound{}
+			q.items = q.items[1:]
+			q.lock.Unlock()
+			if frame.close {
+				_ = c.Close()
+				return
+			}
+			c.lock.Lock()
+			err := c.write(frame)
+			c.lock.Unlock()
+			if err != nil {
+				q.lock.Lock()
+				q.closed = true
+				q.items = nil
+				q.lock.Unlock()
+				_ = c.Close()
+				return
+			}
+		}
+	}
+}
@@ -1,64 +1,347 @@
 package transport
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/zmhuanf/feng/internal/core"
 	"github.com/zmhuanf/feng/internal/protocol"
 )
 
-var Upgrader = websocket.Upgrader{
-	CheckOrigin: func(*http.Request) bool { return true },
+// NewUpgrader 创建服务端握手器 enableCompression 表示是否协商 permessage-deflate
+// allowedOrigins 为空时允许所有来源
+func NewUpgrader(enableCompression bool, allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin:       OriginChecker(allowedOrigins),
+		Subprotocols:      []string{protocol.Subprotocol},
+		EnableCompression: enableCompression,
+	}
+}
+
+// OriginChecker 按允许列表检查请求的 Origin 不带 Origin 的非浏览器请求总是放行
+// 列表项不区分大小写 * 匹配任意来源 https://*.example.com 匹配其子域名
+func OriginChecker(allowed []string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if len(allowed) == 0 || origin == "" {
+			return true
+		}
+		for _, pattern := range allowed {
+			if matchOrigin(pattern, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, origin) {
+		return true
+	}
+	prefix, suffix, ok := strings.Cut(pattern, "*.")
+	if !ok || !strings.HasSuffix(prefix, "://") {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	return strings.HasPrefix(origin, strings.ToLower(prefix)) && strings.HasSuffix(origin, strings.ToLower("."+suffix))
 }
 
 type Conn struct {
-	conn        *websocket.Conn
-	codec       core.Codec
-	messageType int
-	lock        sync.Mutex
+	conn         *websocket.Conn
+	legacy       *legacyIDs
+	compressor   core.Compressor
+	threshold    int
+	readLimit    int64
+	lock         sync.Mutex
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	queue        atomic.Pointer[sendQueue]
+	rtt          atomic.Int64
+	routes       atomic.Pointer[map[string]uint32]
+	done         chan struct{}
+	closeOnce    sync.Once
 }
 
-func NewConn(conn *websocket.Conn, codec core.Codec) *Conn {
-	return &Conn{conn: conn, codec: codec, messageType: codec.MessageType()}
+// NewConn 包装 WebSocket 连接 未协商到二进制帧子协议时退回旧版 JSON 信封
+func NewConn(conn *websocket.Conn) *Conn {
+	c := &Conn{conn: conn, done: make(chan struct{})}
+	if conn.Subprotocol() != protocol.Subprotocol {
+		c.legacy = newLegacyIDs()
+	}
+	return c
 }
 
-func Dial(url string, codec core.Codec) (*Conn, error) {
-	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+func Dial(url string, header http.Header, enableCompression bool) (*Conn, *http.Response, error) {
+	dialer := websocket.Dialer{
+		Proxy:             http.ProxyFromEnvironment,
+		HandshakeTimeout:  websocket.DefaultDialer.HandshakeTimeout,
+		Subprotocols:      []string{protocol.Subprotocol},
+		EnableCompression: enableCompression,
+	}
+	conn, resp, err := dialer.Dial(url, header)
 	if err != nil {
-		return nil, err
+		return nil, resp, err
 	}
-	return NewConn(conn, codec), nil
+	return NewConn(conn), resp, nil
+}
+
+// SetReadLimit 设置单条消息的最大字节数 超出时读取失败并关闭连接
+// permessage-deflate 和应用层压缩的载荷都按解压后的大小计算
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+	c.conn.SetReadLimit(limit)
+}
+
+// Legacy 判断连接是否使用旧版 JSON 信封
+func (c *Conn) Legacy() bool {
+	return c.legacy != nil
 }
 
 func (c *Conn) Read() (*protocol.Message, error) {
 	for {
-		messageType, data, err := c.conn.ReadMessage()
+		messageType, data, err := c.readMessage()
 		if err != nil {
 			return nil, err
 		}
-		if messageType != c.messageType {
+		if err := c.extendReadDeadline(); err != nil {
+			return nil, err
+		}
+		if c.legacy != nil {
+			if messageType != websocket.TextMessage {
+				continue
+			}
+			return c.legacy.decode(data)
+		}
+		if messageType != websocket.BinaryMessage {
 			continue
 		}
-		var msg protocol.Message
-		if err := c.codec.Unmarshal(data, &msg); err != nil {
+		msg, err := protocol.Decode(data)
+		if err != nil {
 			return nil, err
 		}
-		return &msg, nil
+		return c.decompress(msg)
 	}
 }
 
+// readMessage 读取一条完整消息
+// gorilla 的读取上限只限制线上字节数 permessage-deflate 解压后的大小需要另外限制
+func (c *Conn) readMessage() (int, []byte, error) {
+	messageType, r, err := c.conn.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	if c.readLimit > 0 {
+		r = io.LimitReader(r, c.readLimit+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return messageType, nil, err
+	}
+	if c.readLimit > 0 && int64(len(data)) > c.readLimit {
+		_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseMessageTooBig, ""), time.Now().Add(time.Second))
+		return messageType, nil, websocket.ErrReadLimit
+	}
+	return messageType, data, nil
+}
+
+// Send 发送消息 启用发送队列后只负责入队 消息总会被保留
 func (c *Conn) Send(msg *protocol.Message) error {
-	data, err := c.codec.Marshal(msg)
+	return c.send(msg, false, "")
+}
+
+// SendDroppable 发送可丢弃的推送 发送队列满时可被丢弃 key 非空时可被同 key 的新推送合并
+func (c *Conn) SendDroppable(msg *protocol.Message, key string) error {
+	return c.send(msg, true, key)
+}
+
+func (c *Conn) send(msg *protocol.Message, droppable bool, key string) error {
+	frame, err := c.encode(msg)
 	if err != nil {
 		return err
 	}
+	return c.sendFrame(frame, droppable, key)
+}
+
+// sendFrame 将编码完成的一帧入队或直接写出
+func (c *Conn) sendFrame(frame outbound, droppable bool, key string) error {
+	if queue := c.queue.Load(); queue != nil {
+		frame.droppable, frame.key = droppable, key
+		return queue.push(c, frame)
+	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	return c.conn.WriteMessage(c.messageType, data)
+	return c.write(frame)
+}
+
+func (c *Conn) encode(msg *protocol.Message) (outbound, error) {
+	if c.legacy != nil {
+		data, err := c.legacy.encode(msg)
+		return outbound{messageType: websocket.TextMessage, data: data}, err
+	}
+	compressed, err := c.compress(c.compressRoute(msg))
+	if err != nil {
+		return outbound{}, err
+	}
+	return outbound{messageType: websocket.BinaryMessage, data: protocol.Encode(compressed)}, nil
+}
+
+// write 写出一帧 调用方需保证同一时间只有一个写入者
+func (c *Conn) write(frame outbound) error {
+	if c.writeTimeout > 0 {
+		if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return err
+		}
+	}
+	// 小消息不值得压缩 未协商 permessage-deflate 时该设置无效
+	c.conn.EnableWriteCompression(len(frame.data) >= c.threshold)
+	return c.conn.WriteMessage(frame.messageType, frame.data)
+}
+
+// SetWriteTimeout 设置单条消息的写超时 小于等于 0 时不限制
+func (c *Conn) SetWriteTimeout(timeout time.Duration) {
+	c.writeTimeout = timeout
+}
+
+// SetCompression 设置协商得到的载荷压缩算法 小于 threshold 字节的消息不压缩
+func (c *Conn) SetCompression(compressor core.Compressor, threshold int) {
+	c.compressor = compressor
+	c.threshold = threshold
+}
+
+func (c *Conn) compress(msg *protocol.Message) (*protocol.Message, error) {
+	if c.compressor == nil || len(msg.Data) < c.threshold {
+		return msg, nil
+	}
+	data, err := c.compressor.Compress(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	compressed := *msg
+	compressed.Data = data
+	compressed.Compressed = true
+	return &compressed, nil
+}
+
+func (c *Conn) decompress(msg *protocol.Message) (*protocol.Message, error) {
+	if !msg.Compressed {
+		return msg, nil
+	}
+	if c.compressor == nil {
+		return nil, errors.New("compressed payload without negotiated compressor")
+	}
+	data, err := c.compressor.Decompress(msg.Data, int(c.readLimit))
+	if err != nil {
+		return nil, err
+	}
+	msg.Data = data
+	msg.Compressed = false
+	return msg, nil
+}
+
+// NegotiateCompressor 对端支持的算法列表包含本端配置的算法时返回该算法
+func NegotiateCompressor(offer string, compressor core.Compressor) core.Compressor {
+	if compressor == nil {
+		return nil
+	}
+	for _, name := range strings.Split(offer, ",") {
+		if strings.TrimSpace(name) == compressor.Name() {
+			return compressor
+		}
+	}
+	return nil
+}
+
+// SetRemoteRoutes 记录对端的路由编号表 之后发往这些路由的消息改用编号
+func (c *Conn) SetRemoteRoutes(table map[string]uint32) {
+	c.routes.Store(&table)
+}
+
+// SendRouteTable 将本端路由编号表发给对端 旧版 JSON 信封不支持路由编号 直接忽略
+func (c *Conn) SendRouteTable(table map[string]uint32) error {
+	if c.legacy != nil || len(table) == 0 {
+		return nil
+	}
+	return c.Send(&protocol.Message{Type: protocol.MessageTypeRouteTable, Data: protocol.EncodeRouteTable(table)})
+}
+
+func (c *Conn) compressRoute(msg *protocol.Message) *protocol.Message {
+	table := c.routes.Load()
+	if table == nil || msg.Route == "" || msg.RouteID != 0 {
+		return msg
+	}
+	id, ok := (*table)[msg.Route]
+	if !ok {
+		return msg
+	}
+	compressed := *msg
+	compressed.Route = ""
+	compressed.RouteID = id
+	return &compressed
+}
+
+// KeepAlive 每隔 interval 发送一次 ping 超过 interval+timeout 未收到任何数据时 Read 返回超时错误
+// 必须在开始 Read 之前调用 interval 小于等于 0 时不启用
+func (c *Conn) KeepAlive(interval, timeout time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	c.readTimeout = interval + timeout
+	_ = c.extendReadDeadline()
+	c.conn.SetPongHandler(func(data string) error {
+		// pong 原样带回 ping 发出时的时间戳
+		if sent, err := strconv.ParseInt(data, 10, 64); err == nil {
+			c.rtt.Store(int64(time.Since(time.Unix(0, sent))))
+		}
+		return c.extendReadDeadline()
+	})
+	go c.pingLoop(interval, timeout)
+}
+
+func (c *Conn) pingLoop(interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		payload := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+		if err := c.conn.WriteControl(websocket.PingMessage, payload, time.Now().Add(timeout)); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Conn) extendReadDeadline() error {
+	if c.readTimeout <= 0 {
+		return nil
+	}
+	return c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+}
+
+// RTT 返回最近一次 ping/pong 测得的往返时延 未启用心跳时为 0
+func (c *Conn) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// Shutdown 在已排队的消息写出后关闭连接 未启用发送队列时立即关闭
+func (c *Conn) Shutdown() error {
+	if queue := c.queue.Load(); queue != nil {
+		return queue.shutdown(c)
+	}
+	return c.Close()
 }
 
 func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
 	return c.conn.Close()
 }
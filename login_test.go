@@ -0,0 +1,125 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func startLoginServer(t *testing.T, port int, policy DuplicateLoginPolicy, handshake bool) {
+	t.Helper()
+	server := startTestServer(t, port, func(config *ServerConfig) {
+		config.Authenticator = testAuthenticator
+		config.AuthHandshake = handshake
+		config.DuplicateLogin = policy
+	})
+	_ = server.Handle("/remember", func(ctx ServerContext, data string) error {
+		ctx.User().SetExtraData("note", data)
+		if ctx.Room() == nil {
+			return ctx.User().CreateAndJoinRoom()
+		}
+		return nil
+	})
+	_ = server.Handle("/recall", func(ctx ServerContext) (string, error) {
+		note, _ := ctx.User().ExtraData("note")
+		value, _ := note.(string)
+		if ctx.Room() == nil {
+			return value + "@", nil
+		}
+		return value + "@" + ctx.Room().ID(), nil
+	})
+}
+
+// connectKickable 连接并返回收到断开原因的通道
+func connectKickable(t *testing.T, port int, credentials string) (Client, chan error) {
+	t.Helper()
+	reasons := make(chan error, 1)
+	config := NewDefaultClientConfig()
+	config.Port = port
+	config.Credentials = credentials
+	config.EnableReconnect = true
+	config.OnDisconnect = func(err error) { reasons <- err }
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client, reasons
+}
+
+func expectKicked(t *testing.T, reasons chan error) {
+	t.Helper()
+	select {
+	case err := <-reasons:
+		if !errors.Is(err, ErrKicked) {
+			t.Fatalf("expected kicked, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("old connection was not kicked")
+	}
+}
+
+func TestDuplicateLoginReject(t *testing.T) {
+	startLoginServer(t, 22371, DuplicateReject, false)
+	startLoginServer(t, 22372, DuplicateReject, true)
+
+	_, _ = connectKickable(t, 22371, "Bearer dave")
+	if _, err := connectAuthClient(22371, "Bearer dave", false); !errors.Is(err, ErrDuplicateLogin) {
+		t.Fatalf("expected duplicate login on upgrade, got %v", err)
+	}
+
+	first, err := connectAuthClient(22372, "erin", true)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer first.Close()
+	if _, err := connectAuthClient(22372, "erin", true); !errors.Is(err, ErrDuplicateLogin) {
+		t.Fatalf("expected duplicate login on handshake, got %v", err)
+	}
+}
+
+func TestDuplicateLoginKick(t *testing.T) {
+	startLoginServer(t, 22373, DuplicateKick, false)
+
+	old, reasons := connectKickable(t, 22373, "Bearer frank")
+	if err := old.Push("/remember", "old"); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := connectKickable(t, 22373, "Bearer frank")
+	expectKicked(t, reasons)
+
+	// 旧连接的用户被移除 新连接从空白用户开始
+	note, err := Call[any, string](context.Background(), current, "/recall", nil)
+	if err != nil || note[0] != '@' {
+		t.Fatalf("expected fresh user, got %q %v", note, err)
+	}
+	// 被踢下的客户端不重连
+	time.Sleep(300 * time.Millisecond)
+	if note, err := Call[any, string](context.Background(), current, "/recall", nil); err != nil || note[0] != '@' {
+		t.Fatalf("new connection disturbed: %q %v", note, err)
+	}
+}
+
+func TestDuplicateLoginTakeOver(t *testing.T) {
+	startLoginServer(t, 22374, DuplicateTakeOver, false)
+
+	old, reasons := connectKickable(t, 22374, "Bearer grace")
+	if _, err := Call[string, any](context.Background(), old, "/remember", "kept"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := Call[any, string](context.Background(), old, "/recall", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _ := connectKickable(t, 22374, "Bearer grace")
+	expectKicked(t, reasons)
+
+	after, err := Call[any, string](context.Background(), current, "/recall", nil)
+	if err != nil || after != before {
+		t.Fatalf("expected %q after take over, got %q %v", before, after, err)
+	}
+	if _, err := Call[any, string](context.Background(), old, "/recall", nil); err == nil {
+		t.Fatal("expected kicked client to stay disconnected")
+	}
+}
@@ -0,0 +1,109 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnionMiddleware(t *testing.T) {
+	server := startTestServer(t, 22273, nil)
+	var order []string
+	_ = server.Use("/", func(ctx ServerContext, next func() error) error {
+		order = append(order, "outer:before")
+		err := next()
+		order = append(order, "outer:after")
+		// 包装响应
+		ctx.SetResponse([]byte("[" + string(ctx.Response()) + "]"))
+		return err
+	})
+	_ = server.Use("/echo", func(ctx ServerContext, data string) error {
+		order = append(order, "typed:"+data)
+		return nil
+	})
+	_ = server.Use("/echo", func(ctx ServerContext, next func() error) error {
+		order = append(order, "inner:"+ctx.Route())
+		ctx.SetPayload([]byte(strings.ToUpper(string(ctx.Payload()))))
+		return next()
+	})
+	_ = server.Use("/private", func(ctx ServerContext, next func() error) error {
+		return errors.New("forbidden")
+	})
+	_ = server.Handle("/echo", func(ctx ServerContext, data string) (string, error) {
+		order = append(order, "handler:"+data)
+		return data, nil
+	})
+	handled := false
+	_ = server.Handle("/private", func(ctx ServerContext) error {
+		handled = true
+		return nil
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22273
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	var resp string
+	if err := client.Request(context.Background(), "/echo", "hi", func(ctx ClientContext, data string) { resp = data }); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp != "[HI]" {
+		t.Fatalf("expected wrapped response, got %q", resp)
+	}
+	want := []string{"outer:before", "typed:hi", "inner:/echo", "handler:HI", "outer:after"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected order: %v", order)
+	}
+
+	err := client.Request(context.Background(), "/private", nil, func(ClientContext) {})
+	if err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+	if handled {
+		t.Fatal("handler should not run when middleware skips next")
+	}
+}
+
+func TestClientOnionMiddleware(t *testing.T) {
+	server := startTestServer(t, 22274, nil)
+	answers := make(chan string, 1)
+	_ = server.Handle("/ask", func(ctx ServerContext) error {
+		return ctx.User().RequestAsync("/question", "ping", func(ctx ServerContext, data string) { answers <- data })
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22274
+	client := NewClient(config)
+	_ = client.Use("/question", func(ctx ClientContext, next func() error) error {
+		if err := next(); err != nil {
+			return err
+		}
+		ctx.SetResponse([]byte(string(ctx.Response()) + "!"))
+		return nil
+	})
+	_ = client.Handle("/question", func(ctx ClientContext, data string) (string, error) {
+		return data + "-pong", nil
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Request(context.Background(), "/ask", nil, func(ClientContext) {}); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	select {
+	case resp := <-answers:
+		if resp != "ping-pong!" {
+			t.Fatalf("expected ping-pong!, got %q", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no answer from client")
+	}
+}
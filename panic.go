@@ -0,0 +1,11 @@
+package feng
+
+import "github.com/zmhuanf/feng/internal/core"
+
+type PanicPolicy = core.PanicPolicy
+type PanicInfo = core.PanicInfo
+
+const (
+	PanicKeepConnection  = core.PanicKeepConnection
+	PanicCloseConnection = core.PanicCloseConnection
+)
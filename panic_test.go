@@ -0,0 +1,71 @@
+package feng
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	reports := make(chan PanicInfo, 1)
+	server := startTestServer(t, 22275, func(config *ServerConfig) {
+		config.OnPanic = func(info PanicInfo) { reports <- info }
+	})
+	_ = server.Handle("/boom", func(ctx ServerContext) error {
+		var user User
+		_ = user.ID()
+		return nil
+	})
+	_ = server.Handle("/ok", func(ctx ServerContext) (string, error) {
+		return "ok", nil
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22275
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	err := client.Request(context.Background(), "/boom", nil, func(ClientContext) {})
+	if err == nil || err.Error() != ErrInternal.Error() {
+		t.Fatalf("expected sanitized internal error, got %v", err)
+	}
+	select {
+	case info := <-reports:
+		if info.Route != "/boom" || info.UserID == "" || info.MessageID == 0 || len(info.Stack) == 0 {
+			t.Fatalf("incomplete panic info: %+v", info)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnPanic not called")
+	}
+
+	// 默认策略保留连接
+	var resp string
+	if err := client.Request(context.Background(), "/ok", nil, func(ctx ClientContext, data string) { resp = data }); err != nil || resp != "ok" {
+		t.Fatalf("expected connection to survive panic, got %q %v", resp, err)
+	}
+}
+
+func TestPanicCloseConnection(t *testing.T) {
+	server := startTestServer(t, 22276, func(config *ServerConfig) {
+		config.PanicPolicy = PanicCloseConnection
+	})
+	_ = server.Handle("/boom", func(ctx ServerContext) error {
+		panic("boom")
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22276
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Request(context.Background(), "/boom", nil, func(ClientContext) {}); err == nil {
+		t.Fatal("expected request to fail")
+	}
+	waitTestCondition(t, func() bool { return len(server.Users()) == 0 })
+}
@@ -0,0 +1,232 @@
+package feng
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zmhuanf/feng/internal/protocol"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	messages := []*protocol.Message{
+		{Route: "/cocos_test", ID: 1, Type: protocol.MessageTypeRequest, Data: []byte(`{"name":"feng"}`)},
+		{RouteID: 7, ID: 1 << 40, Type: protocol.MessageTypePush, Data: []byte{0, 1, 2}},
+		{ID: 3, Type: protocol.MessageTypeRequestBack, Success: true},
+	}
+	for _, msg := range messages {
+		decoded, err := protocol.Decode(protocol.Encode(msg))
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if decoded.Route != msg.Route || decoded.RouteID != msg.RouteID || decoded.ID != msg.ID ||
+			decoded.Type != msg.Type || decoded.Success != msg.Success || !bytes.Equal(decoded.Data, msg.Data) {
+			t.Fatalf("round trip mismatch: %+v != %+v", decoded, msg)
+		}
+	}
+	if _, err := protocol.Decode([]byte{1, 0, 0, 0, 0}); err != protocol.ErrUnsupportedVersion {
+		t.Fatalf("expected unsupported version, got %v", err)
+	}
+	if _, err := protocol.Decode([]byte{protocol.FrameVersion, 0, 0, 1, 10, 'a'}); err != protocol.ErrInvalidFrame {
+		t.Fatalf("expected invalid frame, got %v", err)
+	}
+}
+
+func TestLegacyEnvelopeClient(t *testing.T) {
+	server := startTestServer(t, 22261, nil)
+	type A struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	_ = server.Handle("/cocos_test", func(ctx ServerContext, a A) (A, error) {
+		if err := ctx.User().Push("/hello", a); err != nil {
+			return a, err
+		}
+		a.Age += 100
+		return a, nil
+	})
+
+	// 旧版客户端不协商子协议 使用 JSON 信封和字符串 ID
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:22261/game", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != "" {
+		t.Fatalf("unexpected subprotocol %q", conn.Subprotocol())
+	}
+	req := protocol.LegacyMessage{Route: "/cocos_test", ID: "b1f2-uuid", Type: protocol.MessageTypeRequest, Data: `{"name":"feng","age":18}`}
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatal(err)
+	}
+
+	var push, back protocol.LegacyMessage
+	if err := conn.ReadJSON(&push); err != nil {
+		t.Fatal(err)
+	}
+	if push.Type != protocol.MessageTypePush || push.Route != "/hello" {
+		t.Fatalf("unexpected push: %+v", push)
+	}
+	if err := conn.WriteJSON(protocol.LegacyMessage{ID: push.ID, Type: protocol.MessageTypePushBack, Success: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&back); err != nil {
+		t.Fatal(err)
+	}
+	if back.ID != req.ID || !back.Success {
+		t.Fatalf("unexpected response: %+v", back)
+	}
+	var a A
+	if err := json.Unmarshal([]byte(back.Data), &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Age != 118 {
+		t.Fatalf("unexpected response data: %+v", a)
+	}
+}
+
+func TestBinaryEnvelopeClient(t *testing.T) {
+	server := startTestServer(t, 22262, nil)
+	_ = server.Handle("/echo", func(ctx ServerContext, data []byte) ([]byte, error) {
+		return data, nil
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22262
+	client := NewClient(config)
+	if err := client.Connect(t.Context()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	payload := []byte{0, 255, '"', '\\'}
+	var resp []byte
+	if err := client.Request(t.Context(), "/echo", payload, func(ctx ClientContext, data []byte) { resp = data }); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if !bytes.Equal(resp, payload) {
+		t.Fatalf("expected %v, got %v", payload, resp)
+	}
+}
+
+func TestRouteTableCompression(t *testing.T) {
+	server := startTestServer(t, 22263, nil)
+	_ = server.Handle("/move", func(ctx ServerContext, data string) (string, error) {
+		return data, ctx.User().Push("/moved", data)
+	})
+
+	dialer := websocket.Dialer{Subprotocols: []string{protocol.Subprotocol}}
+	conn, _, err := dialer.Dial("ws://127.0.0.1:22263/game", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	read := func() *protocol.Message {
+		t.Helper()
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := protocol.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	write := func(msg *protocol.Message) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.BinaryMessage, protocol.Encode(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := read()
+	if first.Type != protocol.MessageTypeRouteTable {
+		t.Fatalf("expected route table first, got %+v", first)
+	}
+	table, err := protocol.DecodeRouteTable(first.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moveID, ok := table["/move"]
+	if !ok {
+		t.Fatalf("route table missing /move: %v", table)
+	}
+
+	write(&protocol.Message{Type: protocol.MessageTypeRouteTable, Data: protocol.EncodeRouteTable(map[string]uint32{"/moved": 9})})
+	write(&protocol.Message{RouteID: moveID, ID: 1, Type: protocol.MessageTypeRequest, Data: []byte("x=1")})
+	push := read()
+	if push.RouteID != 9 || push.Route != "" || string(push.Data) != "x=1" {
+		t.Fatalf("expected compressed push, got %+v", push)
+	}
+	write(&protocol.Message{ID: push.ID, Type: protocol.MessageTypePushBack, Success: true})
+	if back := read(); back.ID != 1 || !back.Success || string(back.Data) != "x=1" {
+		t.Fatalf("unexpected response: %+v", back)
+	}
+
+	// 未知编号返回 route not found 字符串路由仍可用
+	write(&protocol.Message{RouteID: 999, ID: 2, Type: protocol.MessageTypeRequest})
+	if back := read(); back.ID != 2 || back.Success {
+		t.Fatalf("expected failure for unknown route id, got %+v", back)
+	}
+	write(&protocol.Message{Route: "/move", ID: 3, Type: protocol.MessageTypeRequest, Data: []byte("y=2")})
+	push = read()
+	write(&protocol.Message{ID: push.ID, Type: protocol.MessageTypePushBack, Success: true})
+	if back := read(); back.ID != 3 || !back.Success {
+		t.Fatalf("unexpected response: %+v", back)
+	}
+}
+
+func TestRequestBackSpoofing(t *testing.T) {
+	server := startTestServer(t, 22264, nil)
+	config := NewDefaultClientConfig()
+	config.Port = 22264
+	client := NewClient(config)
+	if err := client.Handle("/slow", func(ctx ClientContext) (string, error) {
+		time.Sleep(300 * time.Millisecond)
+		return "genuine", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(t.Context()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+	waitTestCondition(t, func() bool { return len(server.Users()) == 1 })
+	victim := server.Users()[0]
+
+	result := make(chan string, 1)
+	go func() {
+		data, err := victim.RequestRaw(t.Context(), "/slow", nil)
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		result <- string(data)
+	}()
+
+	// 另一个连接猜测请求 ID 伪造应答
+	dialer := websocket.Dialer{Subprotocols: []string{protocol.Subprotocol}}
+	conn, _, err := dialer.Dial("ws://127.0.0.1:22264/game", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	for id := uint64(1); id <= 200; id++ {
+		msg := &protocol.Message{ID: id, Type: protocol.MessageTypeRequestBack, Success: true, Data: []byte(`"forged"`)}
+		if err := conn.WriteMessage(websocket.BinaryMessage, protocol.Encode(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case got := <-result:
+		if !strings.Contains(got, "genuine") {
+			t.Fatalf("expected the victim's own reply, got %s", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("request did not complete")
+	}
+}
@@ -0,0 +1,12 @@
+package feng
+
+import "github.com/zmhuanf/feng/internal/core"
+
+type RateLimit = core.RateLimit
+type RateLimitAction = core.RateLimitAction
+type RateLimitStats = core.RateLimitStats
+
+const (
+	RateLimitReject = core.RateLimitReject
+	RateLimitDrop   = core.RateLimitDrop
+)
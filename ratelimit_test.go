@@ -0,0 +1,126 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zmhuanf/feng/internal/ratelimit"
+)
+
+func TestRouteRateLimit(t *testing.T) {
+	server := startTestServer(t, 22401, func(config *ServerConfig) {
+		config.RouteRateLimits = map[string]RateLimit{
+			"/move":          {Rate: 1, Burst: 3},
+			"/room/:id/chat": {Rate: 1, Burst: 1},
+		}
+	})
+	for _, route := range []string{"/move", "/other", "/room/:id/chat"} {
+		_ = server.Handle(route, func(ctx ServerContext) error { return nil })
+	}
+	client, err := connectAuthClient(22401, "", false)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	limited := 0
+	for range 5 {
+		if _, err := Call[any, any](context.Background(), client, "/move", nil); errors.Is(err, ErrRateLimited) {
+			limited++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Call[any, any](context.Background(), client, "/other", nil); err != nil {
+			t.Fatalf("unlimited route rejected: %v", err)
+		}
+	}
+	if limited != 2 {
+		t.Fatalf("expected 2 limited moves, got %d", limited)
+	}
+
+	// 参数路由按模式共享同一个令牌桶
+	if _, err := Call[any, any](context.Background(), client, "/room/1/chat", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Call[any, any](context.Background(), client, "/room/2/chat", nil); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected chat limited, got %v", err)
+	}
+
+	stats := server.RateLimitStats()
+	if stats.Limited != 3 || stats.Routes["/move"] != 2 || stats.Routes["/room/:id/chat"] != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRateLimitDisconnect(t *testing.T) {
+	server := startTestServer(t, 22402, func(config *ServerConfig) {
+		config.RateLimit = RateLimit{Rate: 0.1, Burst: 1}
+		config.RateLimitAction = RateLimitDrop
+		config.RateLimitDisconnect = 2
+	})
+	_ = server.Handle("/move", func(ctx ServerContext) error { return nil })
+
+	client, reasons := connectKickable(t, 22402, "")
+	for range 3 {
+		_ = client.Push("/move", nil)
+	}
+	select {
+	case err := <-reasons:
+		if !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("expected rate limited, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("client was not disconnected")
+	}
+	if stats := server.RateLimitStats(); stats.Limited != 2 || stats.Disconnected != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	server := startTestServer(t, 22403, func(config *ServerConfig) {
+		config.Authenticator = testAuthenticator
+		config.DuplicateLogin = DuplicateTakeOver
+		config.RateLimit = RateLimit{Rate: 0.01, Burst: 2}
+	})
+	_ = server.Handle("/move", func(ctx ServerContext) error { return nil })
+
+	first, err := connectAuthClient(22403, "Bearer hank", false)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer first.Close()
+	for range 2 {
+		if _, err := Call[any, any](context.Background(), first, "/move", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 未注册的路由共用一个统计键
+	for _, route := range []string{"/a", "/b", "/c"} {
+		if _, err := Call[any, any](context.Background(), first, route, nil); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("expected %s limited, got %v", route, err)
+		}
+	}
+	if stats := server.RateLimitStats(); len(stats.Routes) != 1 || stats.Routes["<unmatched>"] != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 接管后的连接沿用同一用户的令牌桶
+	second, err := connectAuthClient(22403, "Bearer hank", false)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer second.Close()
+	if _, err := Call[any, any](context.Background(), second, "/move", nil); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected bucket to survive take over, got %v", err)
+	}
+}
+
+func BenchmarkRateLimiter(b *testing.B) {
+	limiter := ratelimit.New(RateLimit{Rate: 1e9, Burst: 100}, map[string]RateLimit{"/move": {Rate: 1e9, Burst: 20}})
+	for b.Loop() {
+		limiter.Allow("/move")
+	}
+}
@@ -0,0 +1,185 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProxy 转发 TCP 连接 用于模拟网络中断
+type testProxy struct {
+	listener net.Listener
+	conns    []net.Conn
+	lock     sync.Mutex
+}
+
+func startTestProxy(t *testing.T, port, target int) *testProxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := &testProxy{listener: listener}
+	t.Cleanup(func() {
+		_ = listener.Close()
+		proxy.drop()
+	})
+	go func() {
+		for {
+			src, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			dst, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", target))
+			if err != nil {
+				_ = src.Close()
+				continue
+			}
+			proxy.lock.Lock()
+			proxy.conns = append(proxy.conns, src, dst)
+			proxy.lock.Unlock()
+			go func() { _, _ = io.Copy(dst, src) }()
+			go func() { _, _ = io.Copy(src, dst) }()
+		}
+	}()
+	return proxy
+}
+
+func (p *testProxy) drop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, conn := range p.conns {
+		_ = conn.Close()
+	}
+	p.conns = nil
+}
+
+func TestClientReconnectResume(t *testing.T) {
+	server := startTestServer(t, 22241, func(config *ServerConfig) {
+		config.ResumeTimeout = 5 * time.Second
+	})
+	_ = server.Handle("/whoami", func(ctx ServerContext) (string, error) {
+		return ctx.User().ID(), nil
+	})
+	_ = server.Handle("/set", func(ctx ServerContext, value string) error {
+		ctx.User().SetExtraData("value", value)
+		return nil
+	})
+	_ = server.Handle("/get", func(ctx ServerContext) (string, error) {
+		value, _ := ctx.User().ExtraData("value")
+		return fmt.Sprint(value), nil
+	})
+	release := make(chan struct{})
+	_ = server.Handle("/block", func(ctx ServerContext) error {
+		<-release
+		return nil
+	})
+	defer close(release)
+	proxy := startTestProxy(t, 22242, 22241)
+
+	disconnected := make(chan error, 1)
+	reconnected := make(chan bool, 1)
+	config := NewDefaultClientConfig()
+	config.Port = 22242
+	config.EnableReconnect = true
+	config.ReconnectBaseDelay = 50 * time.Millisecond
+	config.OnDisconnect = func(err error) { disconnected <- err }
+	config.OnReconnect = func(resumed bool) { reconnected <- resumed }
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	var before, after, value string
+	if err := client.Request(context.Background(), "/whoami", nil, func(ctx ClientContext, id string) { before = id }); err != nil {
+		t.Fatalf("whoami failed: %v", err)
+	}
+	if err := client.Request(context.Background(), "/set", "kept", func(ClientContext) {}); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- client.Request(context.Background(), "/block", nil, func(ClientContext) {})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	proxy.drop()
+
+	select {
+	case err := <-blocked:
+		var e *Error
+		if !errors.Is(err, ErrConnectionLost) || !errors.As(err, &e) || e.Code != CodeConnectionLost {
+			t.Fatalf("expected ErrConnectionLost, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending request not failed after disconnect")
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+	select {
+	case resumed := <-reconnected:
+		if !resumed {
+			t.Fatal("expected session to be resumed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnReconnect not called")
+	}
+
+	if err := client.Request(context.Background(), "/whoami", nil, func(ctx ClientContext, id string) { after = id }); err != nil {
+		t.Fatalf("whoami after reconnect failed: %v", err)
+	}
+	if before != after {
+		t.Fatalf("expected same user after resume, got %s and %s", before, after)
+	}
+	if err := client.Request(context.Background(), "/get", nil, func(ctx ClientContext, v string) { value = v }); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if value != "kept" {
+		t.Fatalf("expected extra data to survive resume, got %q", value)
+	}
+}
+
+func TestClientReconnectGiveUp(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	config := NewDefaultServerConfig()
+	config.Addr = "127.0.0.1"
+	config.Port = 22243
+	server := NewServer(config)
+	go func() { _ = server.ListenAndServe(ctx) }()
+	defer cancel()
+	proxy := startTestProxy(t, 22244, 22243)
+	time.Sleep(100 * time.Millisecond)
+
+	gaveUp := make(chan error, 1)
+	clientConfig := NewDefaultClientConfig()
+	clientConfig.Port = 22244
+	clientConfig.EnableReconnect = true
+	clientConfig.ReconnectBaseDelay = 20 * time.Millisecond
+	clientConfig.ReconnectMaxAttempts = 3
+	clientConfig.OnGiveUp = func(err error) { gaveUp <- err }
+	client := NewClient(clientConfig)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	_ = proxy.listener.Close()
+	proxy.drop()
+	select {
+	case err := <-gaveUp:
+		if err == nil {
+			t.Fatal("expected give up cause")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("OnGiveUp not called")
+	}
+}
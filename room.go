@@ -4,3 +4,11 @@ import "github.com/zmhuanf/feng/internal/core"
 
 type Room = core.Room
 type User = core.User
+type RoomOptions = core.RoomOptions
+type HostLeavePolicy = core.HostLeavePolicy
+type HostSelector = core.HostSelector
+
+const (
+	HostLeaveClose   = core.HostLeaveClose
+	HostLeaveMigrate = core.HostLeaveMigrate
+)
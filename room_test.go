@@ -0,0 +1,200 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRoomLifecycle(t *testing.T) {
+	server := startTestServer(t, 22431, func(config *ServerConfig) {
+		config.Authenticator = testAuthenticator
+	})
+	closed := make(chan string, 4)
+	for _, id := range []string{"ann", "ben", "cat"} {
+		config := NewDefaultClientConfig()
+		config.Port = 22431
+		config.Credentials = "Bearer " + id
+		client := NewClient(config)
+		if err := client.Handle("@room_closed", func(ctx ClientContext, roomID string) {
+			closed <- id + ":" + roomID
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Connect(context.Background()); err != nil {
+			t.Fatalf("connect failed: %v", err)
+		}
+		defer client.Close()
+	}
+	waitTestCondition(t, func() bool { return len(server.Users()) == 3 })
+	ann, _ := server.User("ann")
+	ben, _ := server.User("ben")
+	cat, _ := server.User("cat")
+	if ann.Room() != nil || len(server.Rooms()) != 0 {
+		t.Fatal("connection should not create a room")
+	}
+
+	secret, err := server.CreateRoom(RoomOptions{
+		Capacity: 2,
+		Password: "pw",
+		Metadata: map[string]any{"map": "desert"},
+		Private:  true,
+		Creator:  ann,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lobby, err := server.CreateRoom(RoomOptions{Creator: ben})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cat.JoinRoom(lobby); err != nil {
+		t.Fatal(err)
+	}
+	if rooms := server.Rooms(); len(rooms) != 1 || rooms[0].ID() != lobby.ID() {
+		t.Fatalf("private room should be hidden, got %d rooms", len(rooms))
+	}
+	if found, err := server.Room(secret.ID()); err != nil || found != secret {
+		t.Fatalf("private room should be found by ID: %v", err)
+	}
+	if value, _ := secret.Metadata("map"); value != "desert" || secret.Creator() != ann || ann.Room() != secret {
+		t.Fatal("room options not applied")
+	}
+
+	if err := cat.JoinRoom(secret); !errors.Is(err, ErrRoomPassword) || cat.Room() != lobby {
+		t.Fatalf("expected wrong password, got %v", err)
+	}
+	// 加入新房间时离开原房间
+	if err := cat.JoinRoomWithPassword(secret, "pw"); err != nil || cat.Room() != secret || lobby.UserCount() != 1 {
+		t.Fatalf("join failed: %v", err)
+	}
+	if err := ben.JoinRoomWithPassword(secret, "pw"); !errors.Is(err, ErrRoomFull) {
+		t.Fatalf("expected room full, got %v", err)
+	}
+
+	if err := secret.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case item := <-closed:
+			got[item] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("members not notified, got %v", got)
+		}
+	}
+	if !got["ann:"+secret.ID()] || !got["cat:"+secret.ID()] {
+		t.Fatalf("unexpected notifications %v", got)
+	}
+	if ann.Room() != nil || cat.Room() != nil || secret.UserCount() != 0 {
+		t.Fatal("members should leave the closed room")
+	}
+	if _, err := server.Room(secret.ID()); err == nil {
+		t.Fatal("closed room should be removed")
+	}
+	if err := ben.JoinRoomWithPassword(secret, "pw"); !errors.Is(err, ErrRoomClosed) {
+		t.Fatalf("expected room closed, got %v", err)
+	}
+}
+
+func TestRoomHostMigration(t *testing.T) {
+	server := startTestServer(t, 22432, func(config *ServerConfig) {
+		config.Authenticator = testAuthenticator
+	})
+	changed := make(chan string, 8)
+	for _, id := range []string{"ann", "ben", "cat"} {
+		config := NewDefaultClientConfig()
+		config.Port = 22432
+		config.Credentials = "Bearer " + id
+		client := NewClient(config)
+		if err := client.Handle("@host_changed", func(ctx ClientContext, hostID string) {
+			changed <- id + ":" + hostID
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Connect(context.Background()); err != nil {
+			t.Fatalf("connect failed: %v", err)
+		}
+		defer client.Close()
+	}
+	waitTestCondition(t, func() bool { return len(server.Users()) == 3 })
+	ann, _ := server.User("ann")
+	ben, _ := server.User("ben")
+	cat, _ := server.User("cat")
+	expect := func(want ...string) {
+		t.Helper()
+		got := map[string]bool{}
+		for range want {
+			select {
+			case item := <-changed:
+				got[item] = true
+			case <-time.After(2 * time.Second):
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+		for _, item := range want {
+			if !got[item] {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+	}
+
+	room, err := server.CreateRoom(RoomOptions{Creator: ann, HostLeave: HostLeaveMigrate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ben.JoinRoom(room)
+	_ = cat.JoinRoom(room)
+	// 默认转给最早加入的成员
+	if err := ann.LeaveRoom(); err != nil || room.Host() != ben {
+		t.Fatalf("expected ben to be host: %v", err)
+	}
+	expect("ben:ben", "cat:ben")
+	if err := room.SetHost(ann); err == nil {
+		t.Fatal("expected non-member to be rejected")
+	}
+	if err := room.SetHost(cat); err != nil {
+		t.Fatal(err)
+	}
+	expect("ben:cat", "cat:cat")
+
+	// 选择器挑选最后加入的成员
+	last := func(room Room, candidates []User) User { return candidates[len(candidates)-1] }
+	other, err := server.CreateRoom(RoomOptions{Creator: ann, HostLeave: HostLeaveMigrate, HostSelector: last})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ben.JoinRoom(other)
+	_ = cat.JoinRoom(other)
+	// 原房间最后一人离开后关闭
+	if !room.Closed() {
+		t.Fatal("empty room should close")
+	}
+	_ = ann.LeaveRoom()
+	if other.Host() != cat {
+		t.Fatalf("expected selector to pick cat, got %v", other.Host())
+	}
+	expect("ben:cat", "cat:cat")
+
+	// 转移期间加入的用户成为房主 成员同样收到通知 选择器的结果不再覆盖
+	joinDuring := func(room Room, candidates []User) User {
+		_ = ann.JoinRoom(room)
+		return candidates[0]
+	}
+	third, err := server.CreateRoom(RoomOptions{Creator: ben, HostLeave: HostLeaveMigrate, HostSelector: joinDuring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = cat.JoinRoom(third)
+	if err := ben.LeaveRoom(); err != nil || third.Host() != ann {
+		t.Fatalf("expected ann to be host: %v", err)
+	}
+	expect("ann:ann", "cat:ann")
+	select {
+	case item := <-changed:
+		t.Fatalf("unexpected host change %s", item)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
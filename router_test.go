@@ -0,0 +1,92 @@
+package feng
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRouteParams(t *testing.T) {
+	server := startTestServer(t, 22271, nil)
+	_ = server.Handle("/room/:id/chat", func(ctx ServerContext, msg string) (string, error) {
+		return "chat:" + ctx.Param("id") + ":" + msg, nil
+	})
+	_ = server.Handle("/room/list", func(ctx ServerContext) (string, error) {
+		return "list", nil
+	})
+	_ = server.Handle("/files/*path", func(ctx ServerContext) (string, error) {
+		return "file:" + ctx.Param("path"), nil
+	})
+
+	config := NewDefaultClientConfig()
+	config.Port = 22271
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	cases := map[string]string{
+		"/room/42/chat":   "chat:42:hi",
+		"/room/list":      "list",
+		"/files/a/b.json": "file:a/b.json",
+	}
+	for route, want := range cases {
+		var got string
+		if err := client.Request(context.Background(), route, "hi", func(ctx ClientContext, resp string) { got = resp }); err != nil {
+			t.Fatalf("request %s failed: %v", route, err)
+		}
+		if got != want {
+			t.Fatalf("route %s: expected %q, got %q", route, want, got)
+		}
+	}
+	if err := client.Request(context.Background(), "/room/42", nil, func(ClientContext) {}); err == nil {
+		t.Fatal("expected route not found for /room/42")
+	}
+}
+
+func TestRouteConflict(t *testing.T) {
+	server := NewServer(NewDefaultServerConfig())
+	handler := func(ctx ServerContext) error { return nil }
+	if err := server.Handle("/room/:id", handler); err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range []string{"/room/:id", "/room/:rid", "/files/*path/more", "/room/:"} {
+		if err := server.Handle(route, handler); err == nil {
+			t.Fatalf("expected %s to be rejected", route)
+		}
+	}
+	if err := server.Handle("/files/*path", handler); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Handle("/files/*rest", handler); err == nil {
+		t.Fatal("expected duplicate wildcard to be rejected")
+	}
+}
+
+func TestMiddlewareSegmentScope(t *testing.T) {
+	server := startTestServer(t, 22272, nil)
+	var hits []string
+	_ = server.Use("/room", func(ctx ServerContext) error {
+		hits = append(hits, "room:"+ctx.Param("id"))
+		return nil
+	})
+	_ = server.Handle("/room/:id", func(ctx ServerContext) error { return nil })
+	_ = server.Handle("/roomlist", func(ctx ServerContext) error { return nil })
+
+	config := NewDefaultClientConfig()
+	config.Port = 22272
+	client := NewClient(config)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	for _, route := range []string{"/roomlist", "/room/7"} {
+		if err := client.Request(context.Background(), route, nil, func(ClientContext) {}); err != nil {
+			t.Fatalf("request %s failed: %v", route, err)
+		}
+	}
+	if len(hits) != 1 || hits[0] != "room:7" {
+		t.Fatalf("expected middleware only on /room/7, got %v", hits)
+	}
+}
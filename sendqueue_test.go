@@ -0,0 +1,119 @@
+package feng
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startSlowConsumer 连接一个不读取消息的客户端 返回服务器上对应的用户
+func startSlowConsumer(t *testing.T, port int, policy SendQueuePolicy) (User, *websocket.Conn) {
+	t.Helper()
+	server := startTestServer(t, port, func(config *ServerConfig) {
+		config.SendQueueSize = 4
+		config.SendQueuePolicy = policy
+	})
+	conn, _, err := dialTestGame(port, "")
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	for range 100 {
+		if users := server.Users(); len(users) == 1 {
+			return users[0], conn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("user not registered")
+	return nil, nil
+}
+
+// fillSendQueue 推送大块可丢弃数据直到对端 TCP 缓冲区写满 发送队列堆积
+func fillSendQueue(t *testing.T, user User) {
+	t.Helper()
+	blob := strings.Repeat("x", 256<<10)
+	for i := 0; i < 1000; i++ {
+		if err := user.PushDroppable("/blob", blob, ""); err != nil {
+			t.Fatalf("droppable push failed: %v", err)
+		}
+		if user.SendQueueDepth() >= 4 {
+			return
+		}
+	}
+	t.Fatal("send queue never filled")
+}
+
+func TestSendQueueDropOldest(t *testing.T) {
+	user, _ := startSlowConsumer(t, 22411, SendQueueDropOldest)
+	fillSendQueue(t, user)
+
+	start := time.Now()
+	for range 100 {
+		if err := user.PushDroppable("/blob", "more", ""); err != nil {
+			t.Fatalf("droppable push failed: %v", err)
+		}
+	}
+	// 必须保留的推送挤掉最早的可丢弃推送 不会阻塞调用方
+	if err := user.Push("/important", "keep"); err != nil {
+		t.Fatalf("critical push failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("push blocked for %v", elapsed)
+	}
+	if depth := user.SendQueueDepth(); depth > 4 {
+		t.Fatalf("queue grew past capacity: %d", depth)
+	}
+}
+
+func TestSendQueueCoalesce(t *testing.T) {
+	user, conn := startSlowConsumer(t, 22412, SendQueueCoalesce)
+	fillSendQueue(t, user)
+
+	for i := range 10 {
+		if err := user.PushDroppable("/pos", i, "pos"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 合并后对端读到的第一条坐标就是最新值
+	position := ""
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for position == "" {
+		var msg struct {
+			Route string `json:"route"`
+			Data  string `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if msg.Route == "/pos" {
+			position = msg.Data
+		}
+	}
+	if position != "9" {
+		t.Fatalf("expected the latest position, got %s", position)
+	}
+}
+
+func TestSendQueueDisconnect(t *testing.T) {
+	user, conn := startSlowConsumer(t, 22413, SendQueueDisconnect)
+	blob := strings.Repeat("x", 256<<10)
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = user.Push("/blob", blob)
+	}
+	if err == nil {
+		t.Fatal("expected slow consumer to be disconnected")
+	}
+	// 连接已被服务器关闭 读完缓冲区中的数据后返回错误
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				t.Fatal("connection was not closed")
+			}
+			return
+		}
+	}
+}
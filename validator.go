@@ -0,0 +1,9 @@
+package feng
+
+import "github.com/zmhuanf/feng/internal/core"
+
+type Validator = core.Validator
+
+func NewTagValidator() Validator {
+	return core.NewTagValidator()
+}
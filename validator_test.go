@@ -0,0 +1,79 @@
+package feng
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type testCreateRoomReq struct {
+	Name  string `json:"name" validate:"required,min=3"`
+	Size  int    `json:"size" binding:"gte=2,lte=8"`
+	Extra string `json:"-"`
+}
+
+type testRejectValidator struct{}
+
+func (testRejectValidator) Validate(v any) error {
+	return NewError(CodeValidation, "rejected")
+}
+
+func TestValidation(t *testing.T) {
+	server := startTestServer(t, 22351, func(config *ServerConfig) {
+		config.Validator = NewTagValidator()
+	})
+	_ = server.Handle("/room/create", func(ctx ServerContext, req testCreateRoomReq) (string, error) {
+		return req.Name, nil
+	})
+	_ = HandleFunc(server, "/room/create2", func(ctx ServerContext, req *testCreateRoomReq) (string, error) {
+		return req.Name, nil
+	})
+	plain := startTestServer(t, 22352, nil)
+	_ = plain.Handle("/room/create", func(ctx ServerContext, req testCreateRoomReq) (string, error) {
+		return req.Name, nil
+	})
+	custom := startTestServer(t, 22353, func(config *ServerConfig) {
+		config.Validator = testRejectValidator{}
+	})
+	_ = custom.Handle("/room/create", func(ctx ServerContext, req testCreateRoomReq) (string, error) {
+		return req.Name, nil
+	})
+
+	connect := func(port int) Client {
+		config := NewDefaultClientConfig()
+		config.Port = port
+		client := NewClient(config)
+		if err := client.Connect(context.Background()); err != nil {
+			t.Fatalf("connect failed: %v", err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+	client := connect(22351)
+
+	for _, route := range []string{"/room/create", "/room/create2"} {
+		_, err := Call[testCreateRoomReq, string](context.Background(), client, route, testCreateRoomReq{Name: "ab", Size: 9})
+		var e *Error
+		if !errors.As(err, &e) || e.Code != CodeValidation {
+			t.Fatalf("%s: expected validation error, got %v", route, err)
+		}
+		if e.Details["name"] != "min=3" || e.Details["size"] != "lte=8" || len(e.Details) != 2 {
+			t.Fatalf("%s: unexpected details %v", route, e.Details)
+		}
+		if name, err := Call[testCreateRoomReq, string](context.Background(), client, route, testCreateRoomReq{Name: "arena", Size: 4}); err != nil || name != "arena" {
+			t.Fatalf("%s: valid request failed: %q %v", route, name, err)
+		}
+		// 空载荷同样经过 codec 不会跳过校验直接运行处理函数
+		if data, err := client.RequestRaw(context.Background(), route, nil); err == nil {
+			t.Fatalf("%s: empty payload reached the handler: %q", route, data)
+		}
+	}
+
+	// 未配置校验器时不校验
+	if _, err := Call[testCreateRoomReq, string](context.Background(), connect(22352), "/room/create", testCreateRoomReq{}); err != nil {
+		t.Fatalf("expected no validation without validator, got %v", err)
+	}
+	if _, err := Call[testCreateRoomReq, string](context.Background(), connect(22353), "/room/create", testCreateRoomReq{Name: "arena", Size: 4}); err == nil || err.Error() != "rejected" {
+		t.Fatalf("expected custom validator error, got %v", err)
+	}
+}